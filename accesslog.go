@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"regexp"
+)
+
+var accessLog = flag.String("access-log", "", "crawl from the paths requested in this access log, in common or combined log format, instead of from -root")
+
+// requestRx matches the request line of a common or combined log format
+// entry, capturing the path.
+var requestRx = regexp.MustCompile(`"(?:GET|HEAD) (\S+) [^"]*"`)
+
+// checkAccessLog crawls the distinct paths of the GET and HEAD requests in
+// the -access-log file, resolved against the root.
+func checkAccessLog(file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatalf("reading access log: %v", err)
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		m := requestRx.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+		u, err := parseUrl(m[1])
+		if err != nil {
+			continue
+		}
+		if seen[u] || !isInternal(u) {
+			continue
+		}
+		seen[u] = true
+		crawl(u, "")
+	}
+	if err := s.Err(); err != nil {
+		log.Fatalf("reading access log: %v", err)
+	}
+	if *verbose {
+		log.Printf("%d paths from %s", len(seen), file)
+	}
+}
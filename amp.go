@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"golang.org/x/net/html"
+)
+
+var checkAMP = flag.Bool("check-amp", false, `check that AMP pages' canonical pages link back to them with <link rel="amphtml">, and vice versa`)
+
+// An ampLinks is what -check-amp needs to know about a crawled page.
+type ampLinks struct {
+	amp       bool   // the page is an AMP page
+	canonical string // its rel=canonical URL, if any
+	amphtml   string // its rel=amphtml URL, if any
+}
+
+// ampPages maps each page crawled for links to its ampLinks, with
+// -check-amp. It's guarded by mu.
+var ampPages = make(map[string]ampLinks)
+
+// isAMPDoc reports whether n is the <html> element of an AMP page.
+func isAMPDoc(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data != "html" {
+		return false
+	}
+	_, amp := lookupAttr(n, "amp")
+	_, bolt := lookupAttr(n, "⚡")
+	return amp || bolt
+}
+
+func noteAMPLinks(pageURL string, links ampLinks) {
+	mu.Lock()
+	ampPages[pageURL] = links
+	mu.Unlock()
+}
+
+// checkAMPLinks reports AMP pages and their canonical pages that don't
+// link to each other, once the crawl is done.
+func checkAMPLinks() {
+	for page, l := range ampPages {
+		if l.amp {
+			if l.canonical == "" {
+				addProblem(kindAMP, page, "AMP page has no canonical link")
+				continue
+			}
+			if l.canonical == page {
+				// A standalone AMP page is its own canonical.
+				continue
+			}
+			canon, ok := ampPages[l.canonical]
+			switch {
+			case !ok:
+				// The canonical page is broken, or wasn't crawled.
+			case canon.amp:
+				addProblem(kindAMP, page, fmt.Sprintf("canonical %s is an AMP page", l.canonical))
+			case canon.amphtml != page:
+				addProblem(kindAMP, page, fmt.Sprintf("canonical %s doesn't link back with rel=amphtml", l.canonical))
+			}
+			continue
+		}
+		if l.amphtml == "" {
+			continue
+		}
+		amp, ok := ampPages[l.amphtml]
+		switch {
+		case !ok:
+		case !amp.amp:
+			addProblem(kindAMP, page, fmt.Sprintf("amphtml %s isn't an AMP page", l.amphtml))
+		case amp.canonical != page:
+			addProblem(kindAMP, page, fmt.Sprintf("amphtml %s doesn't link back with rel=canonical", l.amphtml))
+		}
+	}
+}
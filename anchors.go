@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	reportInconsistentAnchors = flag.Bool("report-inconsistent-anchors", false, "list link texts used for links to more than one URL, which are often mistakes")
+	checkA11yLinks            = flag.Bool("check-a11y-links", false, "warn about links with no text for screen readers: no text content, image alt text, aria-label, or title")
+)
+
+// anchorTargets maps the normalized text of links to the URLs they link
+// to, with -report-inconsistent-anchors. It's guarded by mu.
+var anchorTargets = make(map[string]map[string]bool)
+
+// An anchorText is link text used for links to different URLs.
+type anchorText struct {
+	Text string   `json:"text"`
+	URLs []string `json:"urls"`
+}
+
+// linkText returns the text of the anchor n, including the alt text of
+// images in it, with whitespace collapsed.
+func linkText(n *html.Node) string {
+	var b strings.Builder
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.Data == "img":
+			b.WriteString(" " + attr(n, "alt") + " ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// hasAccessibleName reports whether the anchor n has a name screen readers
+// can announce.
+func hasAccessibleName(n *html.Node) bool {
+	for _, a := range []string{"aria-label", "aria-labelledby", "title"} {
+		if strings.TrimSpace(attr(n, a)) != "" {
+			return true
+		}
+	}
+	return linkText(n) != ""
+}
+
+// noteAnchor records that a link with text links to ref.
+func noteAnchor(text, ref string) {
+	if text == "" {
+		return
+	}
+	key := strings.ToLower(text)
+	mu.Lock()
+	if anchorTargets[key] == nil {
+		anchorTargets[key] = make(map[string]bool)
+	}
+	anchorTargets[key][ref] = true
+	mu.Unlock()
+}
+
+// inconsistentAnchors returns the link texts used for more than one URL,
+// sorted. It's called once the crawl is done.
+func inconsistentAnchors() []anchorText {
+	var texts []anchorText
+	for text, refs := range anchorTargets {
+		if len(refs) < 2 {
+			continue
+		}
+		a := anchorText{Text: text}
+		for ref := range refs {
+			a.URLs = append(a.URLs, ref)
+		}
+		sort.Strings(a.URLs)
+		texts = append(texts, a)
+	}
+	sort.Slice(texts, func(i, j int) bool { return texts[i].Text < texts[j].Text })
+	return texts
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBandwidth is the -max-bandwidth in bytes per second, 0 for no limit.
+var maxBandwidth bandwidthFlag
+
+func init() {
+	flag.Var(&maxBandwidth, "max-bandwidth", `maximum rate to download response bodies at, across all crawlers, e.g. "500KB/s" or "1MB/s" (0 means no limit)`)
+}
+
+// bandwidthFlag is a flag.Value for a rate in bytes per second, like
+// "1MB/s", "256KiB/s", or just a number of bytes.
+type bandwidthFlag int64
+
+var bandwidthUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	// Longest first, so "KiB" isn't taken for "B".
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9},
+	{"B", 1},
+}
+
+func (b *bandwidthFlag) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *bandwidthFlag) Set(s string) error {
+	v := strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	scale := int64(1)
+	for _, u := range bandwidthUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, scale = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%q isn't a rate like 1MB/s", s)
+	}
+	*b = bandwidthFlag(n * float64(scale))
+	return nil
+}
+
+var (
+	bandwidthMu sync.Mutex
+	nextRead    time.Time // when the bytes read so far are paid for at -max-bandwidth
+)
+
+// throttle waits long enough after reading n bytes to keep the crawlers
+// within -max-bandwidth together. Each read is paid for after it's made,
+// so the rate averages out over reads rather than limiting each one.
+func throttle(n int) {
+	if maxBandwidth <= 0 || n <= 0 {
+		return
+	}
+	bandwidthMu.Lock()
+	now := time.Now()
+	if nextRead.Before(now) {
+		nextRead = now
+	}
+	nextRead = nextRead.Add(time.Duration(int64(n) * int64(time.Second) / int64(maxBandwidth)))
+	wait := nextRead.Sub(now)
+	bandwidthMu.Unlock()
+	time.Sleep(wait)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+)
+
+var (
+	baselineFile   = flag.String("baseline", "", "JSON file of known problems, which are reported but don't fail the crawl")
+	updateBaseline = flag.Bool("update-baseline", false, "write the problems found to the -baseline file instead of reporting them")
+)
+
+// A baselineEntry is a known broken link from one page.
+type baselineEntry struct {
+	Source string `json:"source"`
+	Target string `json:"target"` // including any #fragment
+}
+
+var baseline map[baselineEntry]bool // loaded from -baseline
+
+func loadBaseline(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var entries []baselineEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return err
+	}
+	baseline = make(map[baselineEntry]bool)
+	for _, e := range entries {
+		baseline[e] = true
+	}
+	return nil
+}
+
+func writeBaseline(file string, problems []problem) error {
+	entries := []baselineEntry{}
+	for _, p := range problems {
+		for _, src := range p.Sources {
+			entries = append(entries, baselineEntry{src, p.target()})
+		}
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0666)
+}
+
+// known reports whether every link causing p is in the baseline. A known
+// broken link from a new page is a new problem.
+func known(p problem) bool {
+	if len(p.Sources) == 0 {
+		return baseline[baselineEntry{"", p.target()}]
+	}
+	for _, src := range p.Sources {
+		if !baseline[baselineEntry{src, p.target()}] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyBaseline moves the known problems in data to data.Known. With
+// -fail-on-5xx, server errors are never known.
+func applyBaseline(data *reportData) {
+	if baseline == nil {
+		return
+	}
+	var problems []problem
+	for _, p := range data.Problems {
+		if known(p) && !(*failOn5xx && serverError(p)) {
+			data.Known = append(data.Known, p)
+		} else {
+			problems = append(problems, p)
+		}
+	}
+	data.Problems = problems
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var checkAssetCaching = flag.Bool("check-asset-caching", false, "warn about static assets (stylesheets, scripts, images, and fonts) served without Cache-Control or Expires headers letting browsers cache them for at least a day")
+
+// minAssetCacheAge is the shortest cache lifetime -check-asset-caching
+// accepts for a static asset.
+const minAssetCacheAge = 24 * time.Hour
+
+// isStaticAsset reports whether a Content-Type is of a static asset.
+func isStaticAsset(ct string) bool {
+	mt, _, _ := mime.ParseMediaType(ct)
+	return mt == "text/css" || strings.HasSuffix(mt, "javascript") ||
+		strings.HasPrefix(mt, "image/") || strings.HasPrefix(mt, "font/") ||
+		strings.HasPrefix(mt, "application/font-") || mt == "application/vnd.ms-fontobject"
+}
+
+// checkCaching warns if the static asset at url, with response headers h,
+// may not be cached for minAssetCacheAge.
+func checkCaching(url string, h http.Header) {
+	if why := cacheProblem(h, time.Now()); why != "" {
+		addWarning(url, "static asset "+why)
+	}
+}
+
+// cacheProblem returns why a response with headers h, received at now,
+// may not be cached for minAssetCacheAge, or "".
+func cacheProblem(h http.Header, now time.Time) string {
+	maxAge := -1
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			switch {
+			case d == "no-store" || d == "no-cache":
+				return "has Cache-Control: " + d
+			case strings.HasPrefix(d, "max-age="):
+				if n, err := strconv.Atoi(strings.Trim(d[len("max-age="):], `"`)); err == nil {
+					maxAge = n
+				}
+			}
+		}
+	}
+	// max-age takes precedence over Expires.
+	if maxAge >= 0 {
+		if age := time.Duration(maxAge) * time.Second; age < minAssetCacheAge {
+			return "is cached for only " + age.String()
+		}
+		return ""
+	}
+	if v := h.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil || expires.Sub(now) < minAssetCacheAge {
+			return "expires within " + minAssetCacheAge.String()
+		}
+		return ""
+	}
+	return "has no Cache-Control max-age or Expires header"
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var canonicalCheck = flag.Bool("canonical-check", false, `check that <link rel="canonical"> targets resolve, and warn about canonicals that point to a page with a different canonical`)
+
+// canonicals maps each page URL to the canonical URL it declares, with
+// -canonical-check. It's guarded by mu.
+var canonicals = make(map[string]string)
+
+func noteCanonical(pageURL, canonical string) {
+	mu.Lock()
+	canonicals[pageURL] = canonical
+	mu.Unlock()
+}
+
+// checkCanonicals warns about canonical chains, where a page's canonical
+// page itself declares a different canonical, once the crawl is done.
+func checkCanonicals() {
+	for page, canon := range canonicals {
+		if canon == page {
+			continue
+		}
+		if next, ok := canonicals[canon]; ok && next != canon {
+			addWarning(page, fmt.Sprintf("canonical chain: canonical %s declares canonical %s", canon, next))
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var reportChainLength = flag.Bool("report-chain-length", false, "report how many links redirect, how many redirects they take to reach their final URL, and the longest redirect chains, to find hops to flatten")
+
+var reportRedirects = flag.Bool("report-redirects", false, "list each link that redirects with the final URL it redirects to, to link to directly instead")
+
+// maxLongestChains is how many of the longest redirect chains are
+// reported.
+const maxLongestChains = 5
+
+// redirectTargets maps each URL that redirected to where it redirected.
+// Off-site URLs are only followed, and so in it, with -report-chain-length,
+// -report-redirects, or -fix. Guarded by mu.
+var redirectTargets = make(map[string]string)
+
+// redirectStarts holds the URLs in redirectTargets that weren't themselves
+// reached by a redirect, where chains start. Guarded by mu.
+var redirectStarts = make(map[string]bool)
+
+// A chainStats summarizes the redirect chains of a crawl.
+type chainStats struct {
+	Redirecting int         `json:"redirecting"` // links that redirect
+	Lengths     map[int]int `json:"lengths"`     // redirects to the final URL -> links
+	Longest     [][]string  `json:"longest"`     // the longest chains, from link to final URL
+}
+
+// noteRedirect records a redirect from url to target.
+func noteRedirect(url, target string) {
+	if i := strings.Index(target, "#"); i >= 0 {
+		target = target[:i]
+	}
+	mu.Lock()
+	if _, ok := redirects[url]; !ok {
+		redirectStarts[url] = true
+	}
+	redirectTargets[url] = target
+	mu.Unlock()
+}
+
+// followOffsite follows the redirects from the off-site url, which from
+// redirected to, recording each hop, so that where the chain ends is known.
+// Off-site redirects aren't crawled, so the URLs aren't otherwise checked.
+// It stops after -max-redirects, and at a URL whose redirect is already
+// known, as in a loop.
+func followOffsite(from, url string) {
+	if i := strings.Index(url, "#"); i >= 0 {
+		url = url[:i]
+	}
+	for redirectHop(from, url) {
+		mu.Lock()
+		_, known := redirectTargets[url]
+		over := !known && overBudget(url)
+		mu.Unlock()
+		if known || over {
+			return
+		}
+		if *robotsDelay {
+			waitForHost(url)
+		}
+		next, ok := redirectLocation(url)
+		if !ok {
+			return
+		}
+		noteRedirect(url, next)
+		from, url = url, next
+	}
+}
+
+// redirectLocation requests url, returning where it redirects to, if it
+// does.
+func redirectLocation(url string) (string, bool) {
+	req, err := http.NewRequest(requestMethod(url), url, nil)
+	if err != nil {
+		return "", false
+	}
+	res, err := roundTrip(req)
+	if err != nil {
+		return "", false
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 3 {
+		return "", false
+	}
+	next, err := res.Location()
+	if err != nil {
+		return "", false
+	}
+	normalizeHost(next)
+	next.Fragment = ""
+	return next.String(), true
+}
+
+// checkRedirectLoops reports the links whose redirects loop, so never
+// reach a page.
+func checkRedirectLoops() {
+	mu.Lock()
+	var loops [][]string
+	for url := range redirectStarts {
+		if chain := redirectChain(url); looped(chain) {
+			loops = append(loops, chain)
+		}
+	}
+	mu.Unlock()
+	for _, chain := range loops {
+		addProblem(kindRedirect, chain[0], "redirect loop: "+strings.Join(chain, " -> "))
+	}
+}
+
+// looped reports whether a redirectChain ends by looping back to a URL
+// already in it.
+func looped(chain []string) bool {
+	last := chain[len(chain)-1]
+	for _, url := range chain[:len(chain)-1] {
+		if url == last {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectChains returns the statistics of the redirect chains starting
+// at each link that redirected, not counting the URLs only reached by
+// redirects.
+func redirectChains() *chainStats {
+	mu.Lock()
+	defer mu.Unlock()
+	stats := &chainStats{Lengths: make(map[int]int), Longest: [][]string{}}
+	var chains [][]string
+	for url := range redirectStarts {
+		chain := redirectChain(url)
+		stats.Redirecting++
+		stats.Lengths[len(chain)-1]++
+		chains = append(chains, chain)
+	}
+	sort.Slice(chains, func(i, j int) bool {
+		if len(chains[i]) != len(chains[j]) {
+			return len(chains[i]) > len(chains[j])
+		}
+		return chains[i][0] < chains[j][0]
+	})
+	if len(chains) > maxLongestChains {
+		chains = chains[:maxLongestChains]
+	}
+	stats.Longest = append(stats.Longest, chains...)
+	return stats
+}
+
+// redirectChain returns the URLs redirected through from url, starting
+// with url. Must hold mu.
+func redirectChain(url string) []string {
+	chain := []string{url}
+	seen := map[string]bool{url: true}
+	for next, ok := redirectTargets[url]; ok; next, ok = redirectTargets[next] {
+		chain = append(chain, next)
+		if seen[next] {
+			break // a loop
+		}
+		seen[next] = true
+	}
+	return chain
+}
+
+// writeChainStats writes the redirect chain statistics in the text report.
+func writeChainStats(w io.Writer, s *chainStats) {
+	lengths := make([]int, 0, len(s.Lengths))
+	for n := range s.Lengths {
+		lengths = append(lengths, n)
+	}
+	sort.Ints(lengths)
+	parts := make([]string, len(lengths))
+	for i, n := range lengths {
+		parts[i] = strconv.Itoa(n) + ": " + strconv.Itoa(s.Lengths[n])
+	}
+	fmt.Fprintf(w, "Redirects: %d links redirect, by chain length %s\n", s.Redirecting, strings.Join(parts, ", "))
+	for _, c := range s.Longest {
+		fmt.Fprintf(w, "Redirect chain of %d: %s\n", len(c)-1, strings.Join(c, " -> "))
+	}
+}
+
+// A redirectedLink is a link that redirects, with -report-redirects.
+type redirectedLink struct {
+	URL     string   `json:"url"`
+	Final   string   `json:"final"` // the URL at the end of its redirects
+	Sources []string `json:"sources"`
+}
+
+func (r redirectedLink) String() string {
+	return fmt.Sprintf("Redirect from %s to %s (from %s)", r.URL, r.Final, r.Sources)
+}
+
+// redirectedLinks returns the links that redirected, with their final
+// URLs, sorted by URL. URLs only reached by redirects aren't included, nor
+// are links whose redirects loop, which checkRedirectLoops reports.
+func redirectedLinks() []redirectedLink {
+	mu.Lock()
+	defer mu.Unlock()
+	links := []redirectedLink{}
+	for url := range redirectStarts {
+		chain := redirectChain(url)
+		if looped(chain) {
+			continue
+		}
+		srcs := sources(url)
+		sort.Strings(srcs)
+		links = append(links, redirectedLink{URL: url, Final: chain[len(chain)-1], Sources: srcs})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].URL < links[j].URL })
+	return links
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestRedirectedLinks checks that -report-redirects follows a link's
+// redirects off the site to the last of them, and that a loop of
+// redirects is reported as broken.
+func TestRedirectedLinks(t *testing.T) {
+	ext := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		default:
+			fmt.Fprint(w, "external")
+		}
+	}))
+	defer ext.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, ext.URL+"/a", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop2", http.StatusFound)
+		case "/loop2":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<!doctype html><title>root</title><a href="/old">old</a><a href="/loop">loop</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	data := crawlTest(t, ts.URL, map[string]string{"report-redirects": "true"})
+	want := []redirectedLink{{URL: ts.URL + "/old", Final: ext.URL + "/c", Sources: []string{ts.URL + "/"}}}
+	if !reflect.DeepEqual(data.Redirects, want) {
+		t.Errorf("redirects %v, want %v", data.Redirects, want)
+	}
+	if len(data.Problems) != 1 || data.Problems[0].Kind != kindRedirect || data.Problems[0].URL != ts.URL+"/loop" {
+		t.Fatalf("problems %v, want the loop from %s/loop", data.Problems, ts.URL)
+	}
+	if got, want := data.Problems[0].Err, "redirect loop: "+ts.URL+"/loop -> "+ts.URL+"/loop2 -> "+ts.URL+"/loop"; got != want {
+		t.Errorf("loop reported as %q, want %q", got, want)
+	}
+}
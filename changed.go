@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/url"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	changedSince = flag.String("changed-since", "", "only check the links in the HTML and Markdown files changed since this git ref")
+	siteDir      = flag.String("site-dir", ".", "with -changed-since, the directory in the git repository whose files are served at -root")
+)
+
+// changedPages are the URLs of the changed HTML files with -changed-since.
+// Other pages aren't crawled further. It's set before crawling starts and
+// guarded by mu.
+var changedPages map[string]bool
+
+// changedFiles returns the files under dir changed since the git ref,
+// relative to dir.
+func changedFiles(dir, ref string) ([]string, error) {
+	// With -z, names are as they are, not quoted, and can have spaces.
+	cmd := exec.Command("git", "diff", "-z", "--name-only", "--relative", "--diff-filter=d", ref, "--", ".")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// checkChanged checks the links in the files changed since -changed-since.
+// Changed HTML files are crawled at their URLs under the root, but the
+// pages they link to are only checked. Changed Markdown files are checked
+// as with -markdown.
+func checkChanged() {
+	files, err := changedFiles(*siteDir, *changedSince)
+	if err != nil {
+		log.Fatalf("listing files changed since %s: %v", *changedSince, err)
+	}
+	pages := make(map[string]bool)
+	var mdFiles []string
+	for _, f := range files {
+		switch path.Ext(f) {
+		case ".html", ".htm":
+			pages[siteURL(f)] = true
+		case ".md":
+			mdFiles = append(mdFiles, filepath.Join(*siteDir, f))
+		}
+	}
+	if *verbose {
+		log.Printf("%d changed pages, %d changed Markdown files", len(pages), len(mdFiles))
+	}
+	mu.Lock()
+	changedPages = pages
+	mu.Unlock()
+
+	for _, f := range mdFiles {
+		checkMarkdownFile(f)
+	}
+	for page := range pages {
+		crawl(page, "")
+	}
+}
+
+// siteURL returns the URL at which the file with the given path relative
+// to -site-dir is served, with the path escaped as parseUrl would.
+func siteURL(file string) string {
+	p := filepath.ToSlash(file)
+	if path.Base(p) == "index.html" {
+		p = strings.TrimSuffix(p, "index.html")
+	}
+	u := url.URL{Scheme: base.Scheme, Host: base.Host, Path: strings.TrimSuffix(base.Path, "/") + "/" + p}
+	return u.String()
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestSiteURL(t *testing.T) {
+	var err error
+	if base, err = url.Parse("http://example.com/docs/"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file, url string
+	}{
+		{"index.html", "http://example.com/docs/"},
+		{"guide/index.html", "http://example.com/docs/guide/"},
+		{"my page.html", "http://example.com/docs/my%20page.html"},
+		{"ü.html", "http://example.com/docs/%C3%BC.html"},
+		{"a#b/c?.html", "http://example.com/docs/a%23b/c%3F.html"},
+		{"100%.html", "http://example.com/docs/100%25.html"},
+	}
+	for _, tt := range tests {
+		if got := siteURL(tt.file); got != tt.url {
+			t.Errorf("siteURL(%q) = %q, want %q", tt.file, got, tt.url)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+var checkpointInterval = flag.Duration("checkpoint-interval", 0, "with -report-dir, also write the report so far there at this interval during the crawl, to follow a long crawl; the final report overwrites the last one")
+
+// startCheckpoints writes the report so far to the -report-dir every
+// -checkpoint-interval until the returned func is called.
+func startCheckpoints() (stop func()) {
+	if *checkpointInterval <= 0 {
+		return func() {}
+	}
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(*checkpointInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := writeReportDir(*reportDir, checkpointData()); err != nil {
+					log.Printf("writing checkpoint: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// checkpointData returns the report of the crawl so far. The problems are
+// copied, so sorting them doesn't disturb the crawl.
+func checkpointData() reportData {
+	mu.Lock()
+	checked := crawledCount()
+	mu.Unlock()
+	problemsMu.Lock()
+	data := reportData{
+		Problems:    copyProblems(problems),
+		Warnings:    copyProblems(warnings),
+		Suppressed:  suppressed,
+		Streamed:    streamed,
+		Stopped:     stopping,
+		Interrupted: interrupted,
+		Checked:     checked,
+		Bytes:       atomic.LoadInt64(&bytesRead),
+		Results:     append([]pageResult(nil), results...),
+		Statuses:    make(map[string]int),
+		Partial:     true,
+	}
+	for c, n := range statuses {
+		data.Statuses[c] = n
+	}
+	problemsMu.Unlock()
+	sortProblems(data.Problems)
+	sortProblems(data.Warnings)
+	return data
+}
+
+func copyProblems(ps []problem) []problem {
+	out := make([]problem, len(ps))
+	for i, p := range ps {
+		p.Sources = append([]string(nil), p.Sources...)
+		out[i] = p
+	}
+	return out
+}
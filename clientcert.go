@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"net/http"
+)
+
+var (
+	clientCert = flag.String("client-cert", "", "PEM file with a TLS client certificate to present to the root's host, for mutual TLS")
+	clientKey  = flag.String("client-key", "", "PEM file with the private key for -client-cert")
+)
+
+// siteTransport makes the requests to the root's host. It presents the
+// -client-cert, if any, which isn't sent to other hosts. It's set in main.
+var siteTransport http.RoundTripper = http.DefaultTransport
+
+// otherTransport makes the requests to other hosts.
+var otherTransport http.RoundTripper = http.DefaultTransport
+
+// loadClientCert sets up siteTransport to present the -client-cert.
+func loadClientCert() error {
+	cert, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+	if err != nil {
+		return err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	siteTransport = t
+	return nil
+}
+
+// transportFor returns the transport to use for req.
+func transportFor(req *http.Request) http.RoundTripper {
+	if req.URL.Scheme == base.Scheme && req.URL.Host == base.Host {
+		return siteTransport
+	}
+	return otherTransport
+}
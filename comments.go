@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var checkCommentedLinks = flag.Bool("check-commented-links", false, "also check (but don't crawl) the href and src URLs in HTML comments, for links staged in comments before they go live")
+
+// commentedRefs returns the href and src attributes of the elements in
+// the HTML comment n.
+func commentedRefs(n *html.Node) []string {
+	if n.Type != html.CommentNode || !strings.Contains(n.Data, "=") {
+		return nil
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(n.Data), body)
+	if err != nil {
+		return nil
+	}
+	var refs []string
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, a := range []string{"href", "src"} {
+				if ref, ok := cleanHref(attr(n, a)); ok && ref != "" {
+					refs = append(refs, ref)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	for _, n := range nodes {
+		f(n)
+	}
+	return refs
+}
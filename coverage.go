@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sort"
+)
+
+var sitemapCoverage = flag.String("sitemap-coverage", "", "after crawling from -root, check the URLs in this sitemap or sitemap index that the crawl didn't reach, and report for each sitemap URL whether it was reached, its status, and its broken links")
+
+// A coverageRow is a sitemap URL in the -sitemap-coverage report.
+type coverageRow struct {
+	URL         string `json:"url"`
+	Reached     bool   `json:"reached"` // by crawling from the root
+	Status      int    `json:"status,omitempty"`
+	Error       string `json:"error,omitempty"`
+	BrokenLinks int    `json:"broken_links"`
+}
+
+// sitemapReached maps each -sitemap-coverage URL to whether the crawl from
+// the root reached it. It's set once that crawl is done.
+var sitemapReached map[string]bool
+
+// crawlSitemapCoverage records which sitemap URLs the crawl reached and
+// crawls the rest. It's called once the crawl from the root is done.
+func crawlSitemapCoverage() {
+	u, err := parseUrl(*sitemapCoverage)
+	if err != nil {
+		log.Fatalf("parsing -sitemap-coverage: %v", err)
+	}
+	var locs []string
+	readSitemaps(u, func(loc, _ string) {
+		locs = append(locs, loc)
+	})
+	sitemapReached = make(map[string]bool)
+	mu.Lock()
+	for _, loc := range locs {
+		sitemapReached[loc] = isCrawled(loc)
+	}
+	mu.Unlock()
+	for _, loc := range locs {
+		if !sitemapReached[loc] {
+			crawl(loc, "")
+		}
+	}
+}
+
+// coverage returns the -sitemap-coverage report, sorted by URL.
+func coverage(data reportData) []coverageRow {
+	byURL := make(map[string]pageResult)
+	for _, r := range data.Results {
+		byURL[r.URL] = r
+	}
+	broken := make(map[string]int) // page -> broken links on it
+	for _, p := range data.Problems {
+		for _, src := range p.Sources {
+			broken[src]++
+		}
+	}
+	rows := make([]coverageRow, 0, len(sitemapReached))
+	for loc, reached := range sitemapReached {
+		r := byURL[loc]
+		rows = append(rows, coverageRow{URL: loc, Reached: reached, Status: r.Status, Error: r.Error, BrokenLinks: broken[loc]})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].URL < rows[j].URL })
+	return rows
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"strings"
+)
+
+var dedupContent = flag.Bool("dedup-content", false, "warn about internal pages whose content duplicates another page's, and don't follow their links again")
+
+// contentHashes maps the hash of each page's normalized body to the first
+// URL seen with it, with -dedup-content. It's guarded by mu.
+var contentHashes = make(map[[sha256.Size]byte]string)
+
+// duplicateOf returns the URL of an earlier page with the same content as
+// body, or "" if url is the first, in which case it's recorded. Bodies are
+// compared with runs of whitespace collapsed.
+func duplicateOf(url, body string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(body), " ")))
+	mu.Lock()
+	defer mu.Unlock()
+	if orig, ok := contentHashes[sum]; ok && orig != url {
+		return orig
+	}
+	contentHashes[sum] = url
+	return ""
+}
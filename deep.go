@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var reportDeepPages = flag.Int("report-deep-pages", -1, "warn about pages more than this many clicks from the root (or other starting pages) by the shortest path found, which are hard for users and search engines to reach (-1 means don't)")
+
+// shortestDepths returns the fewest links followed from a starting page to
+// reach each URL. depths records the depth at which each URL was first
+// found, which a concurrent crawl may have reached by a longer path, so
+// it's only an upper bound to improve on by following the links found.
+func shortestDepths() map[string]int {
+	out := make(map[string][]string) // source -> URLs it links to
+	for ref, srcs := range linkSources {
+		if i := strings.Index(ref, "#"); i >= 0 {
+			ref = ref[:i]
+		}
+		for _, src := range srcs {
+			out[src] = append(out[src], ref)
+		}
+	}
+	dist := make(map[string]int, len(depths))
+	byDepth := make(map[int][]string)
+	maxDepth := 0
+	for u, d := range depths {
+		dist[u] = d
+		byDepth[d] = append(byDepth[d], u)
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+	for d := 0; d <= maxDepth; d++ {
+		for _, u := range byDepth[d] {
+			if dist[u] != d {
+				continue // since found closer
+			}
+			for _, v := range out[u] {
+				if dv, ok := dist[v]; ok && dv > d+1 {
+					dist[v] = d + 1
+					byDepth[d+1] = append(byDepth[d+1], v)
+				}
+			}
+		}
+	}
+	return dist
+}
+
+// checkDeepPages warns about the pages deeper than -report-deep-pages,
+// other than broken ones, once the crawl is done.
+func checkDeepPages() {
+	broken := make(map[string]bool)
+	for _, p := range problems {
+		broken[p.URL] = true
+	}
+	for u, d := range shortestDepths() {
+		if d > *reportDeepPages && isInternal(u) && !noRecurse[u] && !idsOnly[u] && !broken[u] {
+			addWarning(u, fmt.Sprintf("page is %d clicks from the root", d))
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+var diffFile = flag.String("diff", "", "JSON report (-format=json) of a previous crawl; report only the links broken or fixed since, and the pages added or removed if it lists its pages")
+
+var previous *reportData // loaded from -diff
+
+// A crawlDiff is the change since the -diff crawl.
+type crawlDiff struct {
+	Broken  []problem `json:"broken"`  // problems new since the previous crawl
+	Fixed   []problem `json:"fixed"`   // the previous crawl's problems that are gone
+	Added   []string  `json:"added"`   // pages crawled that weren't before
+	Removed []string  `json:"removed"` // pages crawled before that weren't now
+}
+
+func loadDiff(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	previous = new(reportData)
+	return json.Unmarshal(b, previous)
+}
+
+// diffCrawls compares data with the previous crawl. Problems are the same
+// if they're with the same URL and fragment, whatever links to them.
+// Pages are only compared if the previous report lists them.
+func diffCrawls(prev, data reportData) *crawlDiff {
+	d := &crawlDiff{
+		Broken: problemsNotIn(data.Problems, prev.Problems),
+		Fixed:  problemsNotIn(prev.Problems, data.Problems),
+	}
+	if len(prev.Pages) > 0 {
+		d.Added = stringsNotIn(data.Pages, prev.Pages)
+		d.Removed = stringsNotIn(prev.Pages, data.Pages)
+	}
+	return d
+}
+
+// problemsNotIn returns the problems in ps with targets not in qs.
+func problemsNotIn(ps, qs []problem) []problem {
+	targets := make(map[string]bool)
+	for _, q := range qs {
+		targets[q.target()] = true
+	}
+	out := []problem{}
+	for _, p := range ps {
+		if !targets[p.target()] {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].target() < out[j].target() })
+	return out
+}
+
+// stringsNotIn returns the sorted strings in ss not in ts.
+func stringsNotIn(ss, ts []string) []string {
+	in := make(map[string]bool)
+	for _, t := range ts {
+		in[t] = true
+	}
+	out := []string{}
+	for _, s := range ss {
+		if !in[s] {
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// writeDiff writes the -diff part of the text report.
+func writeDiff(w io.Writer, d *crawlDiff) {
+	for _, p := range d.Broken {
+		fmt.Fprintf(w, "New: %v\n", p)
+	}
+	for _, p := range d.Fixed {
+		fmt.Fprintf(w, "Fixed: %v\n", p)
+	}
+	for _, u := range d.Added {
+		fmt.Fprintf(w, "Added page %s\n", u)
+	}
+	for _, u := range d.Removed {
+		fmt.Fprintf(w, "Removed page %s\n", u)
+	}
+	fmt.Fprintf(w, "%d newly broken, %d fixed, %d pages added, %d removed since the previous crawl\n",
+		len(d.Broken), len(d.Fixed), len(d.Added), len(d.Removed))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var diskQueueDir = flag.String("disk-queue", "", "keep the URLs waiting to be crawled, and the set of URLs already queued, in files in this directory rather than in memory, for sites with more URLs than fit in memory; what's found on each page, such as the links to it, is still kept in memory")
+
+// A diskQueue is a FIFO queue of URLs kept in a file. URLs are appended at
+// the end and read from the front, so the file only grows, until the
+// queue is reset for the next crawl.
+type diskQueue struct {
+	mu      sync.Mutex
+	ready   *sync.Cond // signaled when a URL is pushed or the queue closed
+	w       *bufio.Writer
+	wf, rf  *os.File
+	r       *bufio.Reader
+	pending int // URLs written but not yet read
+	closed  bool
+}
+
+// Disk queues for the crawlers and -external-crawlers, with -disk-queue.
+var urlDiskq, extDiskq *diskQueue
+
+// newDiskQueue creates an empty queue in the file name in dir.
+func newDiskQueue(dir, name string) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	file := filepath.Join(dir, name)
+	wf, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	rf, err := os.Open(file)
+	if err != nil {
+		wf.Close()
+		return nil, err
+	}
+	q := &diskQueue{wf: wf, w: bufio.NewWriter(wf), rf: rf, r: bufio.NewReader(rf)}
+	q.ready = sync.NewCond(&q.mu)
+	return q, nil
+}
+
+// push adds url to the end of the queue.
+func (q *diskQueue) push(url string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.w.WriteString(url + "\n"); err != nil {
+		log.Fatalf("writing -disk-queue: %v", err)
+	}
+	q.pending++
+	q.ready.Signal()
+}
+
+// pop removes and returns the URL at the front of the queue, waiting for
+// one if it's empty, or returns false once it's closed and empty.
+func (q *diskQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.pending == 0 && !q.closed {
+		q.ready.Wait()
+	}
+	if q.pending == 0 {
+		return "", false
+	}
+	// The reader can only see what's been written out.
+	if err := q.w.Flush(); err != nil {
+		log.Fatalf("writing -disk-queue: %v", err)
+	}
+	line, err := q.r.ReadString('\n')
+	if err != nil {
+		log.Fatalf("reading -disk-queue: %v", err)
+	}
+	q.pending--
+	return strings.TrimSuffix(line, "\n"), true
+}
+
+// feed sends the URLs in q to the crawlers on c until q is closed.
+func (q *diskQueue) feed(c chan<- string) {
+	for {
+		url, ok := q.pop()
+		if !ok {
+			return
+		}
+		c <- url
+	}
+}
+
+// close stops feeding the crawlers, once the queue is empty, and removes
+// its file.
+func (q *diskQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.ready.Broadcast()
+	q.mu.Unlock()
+	q.rf.Close()
+	q.wf.Close()
+	os.Remove(q.wf.Name())
+}
+
+// startDiskQueues creates the -disk-queue queues and starts feeding them
+// to the crawlers.
+func startDiskQueues() {
+	var err error
+	if urlDiskq, err = newDiskQueue(*diskQueueDir, "queue"); err != nil {
+		log.Fatalf("creating -disk-queue: %v", err)
+	}
+	if extDiskq, err = newDiskQueue(*diskQueueDir, "external-queue"); err != nil {
+		log.Fatalf("creating -disk-queue: %v", err)
+	}
+	go urlDiskq.feed(urlq)
+	go extDiskq.feed(extq)
+}
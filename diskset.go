@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// A diskSet is a set of URLs kept in files, so that its size isn't bounded
+// by memory: the URLs are appended to one, and the other is a hash table,
+// with open addressing, of each URL's hash and offset in the first. It
+// isn't safe for concurrent use.
+type diskSet struct {
+	dir         string
+	urls, index *os.File
+	end         int64  // size of urls
+	n           int    // URLs in the set
+	slots       uint64 // slots in index, a power of two
+}
+
+// A diskSet index slot holds a URL's hash, then 1 plus its offset, so that
+// an empty slot is all zeroes.
+const diskSetSlot = 16
+
+// seenDisk holds the URLs seen, instead of crawled, with -disk-queue;
+// guarded by mu. It's kept until the next crawl, so that they can still be
+// looked up when the crawl is reported.
+var seenDisk *diskSet
+
+// newDiskSet creates an empty set in files in dir.
+func newDiskSet(dir string) (*diskSet, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	urls, err := os.Create(filepath.Join(dir, "seen"))
+	if err != nil {
+		return nil, err
+	}
+	s := &diskSet{dir: dir, urls: urls, slots: 1 << 16}
+	if s.index, err = createIndex(filepath.Join(dir, "seen-index"), s.slots); err != nil {
+		urls.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// createIndex creates an index file of empty slots.
+func createIndex(file string, slots uint64) (*os.File, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(int64(slots * diskSetSlot)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func hashURL(url string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(url))
+	return h.Sum64()
+}
+
+// find returns the slot for url, whose hash is h: the slot holding it, if
+// it's in the set, or else the empty slot it belongs in.
+func (s *diskSet) find(url string, h uint64) (slot uint64, found bool, err error) {
+	var buf [diskSetSlot]byte
+	for i := h & (s.slots - 1); ; i = (i + 1) & (s.slots - 1) {
+		if _, err := s.index.ReadAt(buf[:], int64(i*diskSetSlot)); err != nil {
+			return 0, false, err
+		}
+		off := binary.LittleEndian.Uint64(buf[8:])
+		if off == 0 {
+			return i, false, nil
+		}
+		if binary.LittleEndian.Uint64(buf[:8]) != h {
+			continue
+		}
+		u, err := s.read(int64(off - 1))
+		if err != nil {
+			return 0, false, err
+		}
+		if u == url {
+			return i, true, nil
+		}
+	}
+}
+
+// read returns the URL at off in the URLs file.
+func (s *diskSet) read(off int64) (string, error) {
+	var n [4]byte
+	if _, err := s.urls.ReadAt(n[:], off); err != nil {
+		return "", err
+	}
+	b := make([]byte, binary.LittleEndian.Uint32(n[:]))
+	if _, err := s.urls.ReadAt(b, off+4); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// has reports whether url is in the set.
+func (s *diskSet) has(url string) bool {
+	_, found, err := s.find(url, hashURL(url))
+	if err != nil {
+		log.Fatalf("reading -disk-queue: %v", err)
+	}
+	return found
+}
+
+// add adds url to the set.
+func (s *diskSet) add(url string) {
+	h := hashURL(url)
+	i, found, err := s.find(url, h)
+	if err != nil {
+		log.Fatalf("reading -disk-queue: %v", err)
+	}
+	if found {
+		return
+	}
+	rec := make([]byte, 4+len(url))
+	binary.LittleEndian.PutUint32(rec, uint32(len(url)))
+	copy(rec[4:], url)
+	if _, err := s.urls.WriteAt(rec, s.end); err != nil {
+		log.Fatalf("writing -disk-queue: %v", err)
+	}
+	var slot [diskSetSlot]byte
+	binary.LittleEndian.PutUint64(slot[:8], h)
+	binary.LittleEndian.PutUint64(slot[8:], uint64(s.end)+1)
+	if _, err := s.index.WriteAt(slot[:], int64(i*diskSetSlot)); err != nil {
+		log.Fatalf("writing -disk-queue: %v", err)
+	}
+	s.end += int64(len(rec))
+	s.n++
+	// Keep the table at most half full, so that lookups stay short.
+	if uint64(s.n)*2 > s.slots {
+		if err := s.grow(); err != nil {
+			log.Fatalf("writing -disk-queue: %v", err)
+		}
+	}
+}
+
+// grow doubles the slots in the index, moving each URL's slot to its place
+// in the new one.
+func (s *diskSet) grow() error {
+	slots := s.slots * 2
+	file := filepath.Join(s.dir, "seen-index")
+	index, err := createIndex(file+".new", slots)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 1024*diskSetSlot)
+	var slot [diskSetSlot]byte
+	for at := int64(0); at < int64(s.slots*diskSetSlot); at += int64(len(buf)) {
+		if _, err := s.index.ReadAt(buf, at); err != nil {
+			index.Close()
+			return err
+		}
+		for b := buf; len(b) > 0; b = b[diskSetSlot:] {
+			if binary.LittleEndian.Uint64(b[8:diskSetSlot]) == 0 {
+				continue
+			}
+			h := binary.LittleEndian.Uint64(b[:8])
+			for i := h & (slots - 1); ; i = (i + 1) & (slots - 1) {
+				if _, err := index.ReadAt(slot[:], int64(i*diskSetSlot)); err != nil {
+					index.Close()
+					return err
+				}
+				if binary.LittleEndian.Uint64(slot[8:]) != 0 {
+					continue
+				}
+				if _, err := index.WriteAt(b[:diskSetSlot], int64(i*diskSetSlot)); err != nil {
+					index.Close()
+					return err
+				}
+				break
+			}
+		}
+	}
+	s.index.Close()
+	if err := os.Rename(file+".new", file); err != nil {
+		index.Close()
+		return err
+	}
+	s.index, s.slots = index, slots
+	return nil
+}
+
+// len returns the number of URLs in the set.
+func (s *diskSet) len() int {
+	return s.n
+}
+
+// close removes the set's files.
+func (s *diskSet) close() {
+	s.urls.Close()
+	s.index.Close()
+	os.Remove(filepath.Join(s.dir, "seen"))
+	os.Remove(filepath.Join(s.dir, "seen-index"))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// TestDiskSet checks that a diskSet holds each URL added once, including
+// after its index has grown.
+func TestDiskSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "linkcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := newDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	const n = 100000
+	for i := 0; i < n; i++ {
+		s.add(fmt.Sprintf("http://example.com/%d", i))
+	}
+	s.add("http://example.com/7")
+	if s.len() != n {
+		t.Errorf("len %d, want %d", s.len(), n)
+	}
+	if s.slots < 2*n {
+		t.Errorf("%d slots for %d URLs, want the index grown", s.slots, n)
+	}
+	for i := 0; i < n; i += 997 {
+		if u := fmt.Sprintf("http://example.com/%d", i); !s.has(u) {
+			t.Errorf("%s not in the set", u)
+		}
+	}
+	if s.has("http://example.com/") {
+		t.Errorf("http://example.com/ in the set, never added")
+	}
+}
+
+// TestDiskQueueCrawl checks that a crawl with -disk-queue finds the same
+// pages and problems as one in memory.
+func TestDiskQueueCrawl(t *testing.T) {
+	const pages = 300
+	ts := httptest.NewServer(generatedSite(pages))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "linkcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := crawlTest(t, ts.URL, map[string]string{"crawlers": "10", "disk-queue": dir})
+	if want := pages + pages/10; data.Checked != want {
+		t.Errorf("checked %d URLs, want %d", data.Checked, want)
+	}
+	if len(data.Problems) != pages/10 {
+		t.Errorf("%d problems, want %d: %v", len(data.Problems), pages/10, problemURLs(data.Problems))
+	}
+}
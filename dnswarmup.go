@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+var dnsWarmup = flag.Bool("dns-warmup", false, "look up the addresses of external hosts in the background as links to them are found, so they're ready when the links are checked; adds resolver load")
+
+// A lookup is a background DNS lookup of a host with -dns-warmup.
+type lookup struct {
+	done  chan struct{} // closed once addrs is set
+	addrs []string      // nil if the lookup failed
+}
+
+var (
+	lookupsMu sync.Mutex
+	lookups   = make(map[string]*lookup) // host -> its lookup
+)
+
+// warmDNS starts looking up the host of ref, unless it's already been.
+func warmDNS(ref string) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+		return
+	}
+	host := u.Hostname()
+	lookupsMu.Lock()
+	defer lookupsMu.Unlock()
+	if lookups[host] != nil {
+		return
+	}
+	l := &lookup{done: make(chan struct{})}
+	lookups[host] = l
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		addrs, _ := net.DefaultResolver.LookupHost(ctx, host)
+		// IPv4 first, since the addresses are dialed in turn and
+		// IPv6 is more often unreachable.
+		sort.SliceStable(addrs, func(i, j int) bool {
+			return net.ParseIP(addrs[i]).To4() != nil && net.ParseIP(addrs[j]).To4() == nil
+		})
+		l.addrs = addrs
+		close(l.done)
+	}()
+}
+
+// warmedTransport returns a copy of http.DefaultTransport that dials the
+// addresses found by warmDNS, waiting for a lookup still in progress, and
+// otherwise dials as usual.
+func warmedTransport() http.RoundTripper {
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return d.DialContext(ctx, network, addr)
+		}
+		lookupsMu.Lock()
+		l := lookups[host]
+		lookupsMu.Unlock()
+		if l != nil {
+			select {
+			case <-l.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			for _, a := range l.addrs {
+				if conn, err := d.DialContext(ctx, network, net.JoinHostPort(a, port)); err == nil {
+					return conn, nil
+				}
+			}
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+	return t
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"sort"
+)
+
+var dumpIndex = flag.String("dump-index", "", "after the crawl, write each crawled page's links and ids to this JSON file, for other tools to check without crawling again")
+
+// An indexPage is a page in the -dump-index file.
+type indexPage struct {
+	URL   string   `json:"url"`
+	Links []string `json:"links"` // with any fragments
+	IDs   []string `json:"ids"`
+}
+
+// writeIndex writes the links and ids of each crawled page to file, as a
+// JSON array sorted by URL.
+func writeIndex(file string) error {
+	pages := make(map[string]*indexPage)
+	page := func(url string) *indexPage {
+		p := pages[url]
+		if p == nil {
+			p = &indexPage{URL: url, Links: []string{}, IDs: []string{}}
+			pages[url] = p
+		}
+		return p
+	}
+	for target, sources := range linkSources {
+		for _, src := range sources {
+			if isCrawled(src) {
+				p := page(src)
+				p.Links = append(p.Links, target)
+			}
+		}
+	}
+	for uf, sources := range neededFrags {
+		for _, src := range sources {
+			if isCrawled(src) {
+				p := page(src)
+				p.Links = append(p.Links, uf.url+"#"+uf.frag)
+			}
+		}
+	}
+	for url, ids := range idsByPage() {
+		if isCrawled(url) {
+			page(url).IDs = ids
+		}
+	}
+	index := make([]*indexPage, 0, len(pages))
+	for _, p := range pages {
+		p.Links = uniqueSorted(p.Links)
+		p.IDs = uniqueSorted(p.IDs)
+		index = append(index, p)
+	}
+	sort.Slice(index, func(i, j int) bool { return index[i].URL < index[j].URL })
+	b, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0666)
+}
+
+// uniqueSorted sorts ss and removes duplicates.
+func uniqueSorted(ss []string) []string {
+	sort.Strings(ss)
+	out := ss[:0]
+	for i, s := range ss {
+		if i == 0 || s != ss[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
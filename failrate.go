@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxFailureRate is the -max-failure-rate percentage, or -1 if unset.
+var maxFailureRate = percentFlag(-1)
+
+func init() {
+	flag.Var(&maxFailureRate, "max-failure-rate", `exit with status 1 only if more than this percentage of the URLs checked are broken, e.g. "5%", to tolerate a little external link rot but not systemic breakage`)
+}
+
+// percentFlag is a flag.Value for a percentage like "5%" or "5".
+type percentFlag float64
+
+func (p *percentFlag) String() string {
+	if *p < 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(*p), 'g', -1, 64) + "%"
+}
+
+func (p *percentFlag) Set(s string) error {
+	n, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || n < 0 || n > 100 {
+		return fmt.Errorf("%q isn't a percentage like 5%%", s)
+	}
+	*p = percentFlag(n)
+	return nil
+}
+
+// overFailureRate reports whether more than the -max-failure-rate of the
+// URLs checked in data are broken, returning the rate. A URL is broken if
+// it couldn't be fetched or had a bad status, however many problems it
+// has, so that they're counted like the URLs checked.
+func overFailureRate(data reportData) (rate float64, over bool) {
+	broken := make(map[string]bool)
+	for _, p := range data.Problems {
+		if p.Kind == kindFetch || p.Kind == kindStatus {
+			broken[p.URL] = true
+		}
+	}
+	for url := range data.Unlisted {
+		broken[url] = true
+	}
+	failed := len(broken)
+	if data.Checked > 0 {
+		rate = 100 * float64(failed) / float64(data.Checked)
+	} else if failed > 0 {
+		rate = 100
+	}
+	return rate, rate > float64(maxFailureRate)
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+// TestOverFailureRate checks that the failure rate counts the URLs that
+// are broken, not their problems, including those streamed or suppressed.
+func TestOverFailureRate(t *testing.T) {
+	defer func(old percentFlag) { maxFailureRate = old }(maxFailureRate)
+	maxFailureRate = 20
+	data := reportData{
+		Problems: []problem{
+			{Kind: kindStatus, URL: "http://example.com/a"},
+			{Kind: kindFetch, URL: "http://example.com/a"},
+			{Kind: kindFetch, URL: "http://example.com/b"},
+			{Kind: kindFragment, URL: "http://example.com/c", Frag: "z"},
+		},
+		Streamed:   2,
+		Suppressed: 1,
+		Unlisted:   map[string]bool{"http://example.com/b": true, "http://example.com/d": true},
+		Checked:    20,
+	}
+	if rate, over := overFailureRate(data); rate != 15 || over {
+		t.Errorf("rate %v%%, over %v; want 3 of 20 URLs, 15%%, under the limit", rate, over)
+	}
+	data.Checked = 10
+	if rate, over := overFailureRate(data); rate != 30 || !over {
+		t.Errorf("rate %v%%, over %v; want 3 of 10 URLs, 30%%, over the limit", rate, over)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+var checkFeeds = flag.Bool("check-feeds", false, "also follow the item links and check the enclosures in internal RSS and Atom feeds, and the feeds linked to with <link rel=\"alternate\">")
+
+// feedTypes are the content types of feeds. Feeds served as generic XML
+// are recognized by their root element.
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/x-rss+xml": true,
+	"application/atom+xml":  true,
+	"application/xml":       true,
+	"text/xml":              true,
+}
+
+func isFeed(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	return err == nil && feedTypes[mt]
+}
+
+// feedRef returns the URL of n if it's a <link rel="alternate"> to a feed.
+func feedRef(n *html.Node) (string, bool) {
+	if !isLinkRel(n, "alternate") || !isFeed(attr(n, "type")) {
+		return "", false
+	}
+	ref, ok := cleanHref(attr(n, "href"))
+	return ref, ok && ref != ""
+}
+
+// A feed is an RSS 2.0 or Atom feed, with just the links.
+type feed struct {
+	XMLName xml.Name
+	Channel struct { // RSS
+		Link  string `xml:"link"`
+		Items []struct {
+			Link       string `xml:"link"`
+			Enclosures []struct {
+				URL string `xml:"url,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+	Links   []atomLink `xml:"link"` // Atom
+	Entries []struct {
+		Links []atomLink `xml:"link"`
+	} `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+// feedLinks returns the links and the enclosures in the feed data, or
+// ok false if it isn't an RSS or Atom feed.
+func feedLinks(data []byte) (links, enclosures []string, ok bool, err error) {
+	var f feed
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charset.NewReaderLabel
+	if err := d.Decode(&f); err != nil {
+		return nil, nil, false, fmt.Errorf("parsing feed: %v", err)
+	}
+	add := func(refs *[]string, ref string) {
+		if ref, ok := cleanHref(strings.TrimSpace(ref)); ok && ref != "" {
+			*refs = append(*refs, ref)
+		}
+	}
+	atom := func(l atomLink) {
+		if l.Rel == "enclosure" {
+			add(&enclosures, l.Href)
+		} else {
+			add(&links, l.Href)
+		}
+	}
+	switch f.XMLName.Local {
+	case "rss":
+		add(&links, f.Channel.Link)
+		for _, item := range f.Channel.Items {
+			add(&links, item.Link)
+			for _, e := range item.Enclosures {
+				add(&enclosures, e.URL)
+			}
+		}
+	case "feed":
+		for _, l := range f.Links {
+			atom(l)
+		}
+		for _, e := range f.Entries {
+			for _, l := range e.Links {
+				atom(l)
+			}
+		}
+	default:
+		return nil, nil, false, nil
+	}
+	return links, enclosures, true, nil
+}
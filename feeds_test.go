@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFeedLinks(t *testing.T) {
+	tests := []struct {
+		file              string
+		links, enclosures []string
+	}{
+		{"rss.xml", []string{"/", "/post.html", "/deleted.html"}, []string{"/episode.mp3", "/deleted.mp3"}},
+		{"atom.xml", []string{"/", "/atom.xml", "/post.html", "/moved.html"}, []string{"/episode.mp3"}},
+		{"index.html", nil, nil},
+	}
+	for _, tt := range tests {
+		data, err := ioutil.ReadFile(filepath.Join("testdata/feeds", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		links, enclosures, ok, err := feedLinks(data)
+		if tt.links == nil {
+			if ok {
+				t.Errorf("%s: read as a feed", tt.file)
+			}
+			continue
+		}
+		if !ok || err != nil {
+			t.Errorf("%s: not read as a feed: %v", tt.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(links, tt.links) || !reflect.DeepEqual(enclosures, tt.enclosures) {
+			t.Errorf("%s: links %q and enclosures %q, want %q and %q", tt.file, links, enclosures, tt.links, tt.enclosures)
+		}
+	}
+}
+
+// TestCheckFeeds crawls a site whose feeds, linked to from its home page,
+// link to missing posts and enclosures.
+func TestCheckFeeds(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata/feeds")))
+	defer ts.Close()
+
+	data := crawlTest(t, ts.URL, map[string]string{"check-feeds": "true"})
+	got := problemURLs(data.Problems)
+	sort.Strings(got)
+	want := []string{ts.URL + "/deleted.html", ts.URL + "/deleted.mp3", ts.URL + "/moved.html"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with -check-feeds: problems %v, want %v", got, want)
+	}
+	data = crawlTest(t, ts.URL, nil)
+	if len(data.Problems) != 0 {
+		t.Errorf("without -check-feeds: problems %v, want none", problemURLs(data.Problems))
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	fixDir = flag.String("fix", "", "fix links in the site's HTML source files in this directory, as served at the root: missing fragments with a close match on the page (as -fuzzy-fragment-suggestions finds), and internal links that redirect, which are pointed at their final URL; prints the changes as a diff")
+	dryRun = flag.Bool("dry-run", true, "with -fix, only print the diff, without changing any files")
+)
+
+// hrefRx matches an href attribute, capturing its quoted value.
+var hrefRx = regexp.MustCompile(`\bhref\s*=\s*("[^"]*"|'[^']*')`)
+
+// A linkFix replaces links to a URL on a page.
+type linkFix struct {
+	frag string // the fragment to link to instead, or
+	url  string // the URL without fragment to link to instead
+}
+
+// fixLinks rewrites the links the crawl in data found could be fixed, in
+// the source files under dir, and writes the changes to w as a unified
+// diff. With -dry-run, the files aren't changed.
+func fixLinks(dir string, data reportData, w io.Writer) error {
+	fixes := make(map[string]map[string]linkFix) // page -> link, with any fragment as its fragKey -> fix
+	add := func(page, link string, fix linkFix) {
+		if fixes[page] == nil {
+			fixes[page] = make(map[string]linkFix)
+		}
+		fixes[page][link] = fix
+	}
+	broken := make(map[string]bool)
+	for _, p := range data.Problems {
+		if p.Frag == "" {
+			broken[p.URL] = true
+		}
+		if p.Kind == kindFragment && p.Suggestion != "" {
+			// p.Frag is already unescaped, as its fragKey.
+			for _, src := range p.Sources {
+				add(src, p.URL+"#"+p.Frag, linkFix{frag: p.Suggestion})
+			}
+		}
+	}
+	for _, r := range redirectedLinks() {
+		// There's no point pointing a link at a broken page.
+		if isInternal(r.Final) && !broken[r.Final] {
+			for _, src := range r.Sources {
+				add(src, r.URL, linkFix{url: r.Final})
+			}
+		}
+	}
+	pages := make([]string, 0, len(fixes))
+	for page := range fixes {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	for _, page := range pages {
+		file := sourceFile(dir, page)
+		if file == "" {
+			continue
+		}
+		if err := fixFile(dir, file, page, fixes[page], w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceFile returns the file under dir served as page, or "" if there
+// isn't one.
+func sourceFile(dir, page string) string {
+	u, err := url.Parse(page)
+	if err != nil || !isInternal(page) {
+		return ""
+	}
+	file := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(u.Path, base.Path)))
+	for _, f := range []string{file, filepath.Join(file, "index.html"), file + ".html"} {
+		if fi, err := os.Stat(f); err == nil && fi.Mode().IsRegular() {
+			return f
+		}
+	}
+	return ""
+}
+
+// fixFile rewrites the links in file, the source of page, to the URLs in
+// fixes, writing the changed lines to w as a diff.
+func fixFile(dir, file, page string, fixes map[string]linkFix, w io.Writer) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	pageURL, err := url.Parse(page)
+	if err != nil {
+		return err
+	}
+	name := file
+	if rel, err := filepath.Rel(dir, file); err == nil {
+		name = filepath.ToSlash(rel)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	changed := false
+	for i, line := range lines {
+		fixed := hrefRx.ReplaceAllStringFunc(line, func(attr string) string {
+			return fixHref(attr, pageURL, fixes)
+		})
+		if fixed == line {
+			continue
+		}
+		if !changed {
+			fmt.Fprintf(w, "--- a/%s\n+++ b/%s\n", name, name)
+			changed = true
+		}
+		fmt.Fprintf(w, "@@ -%d +%d @@\n-%s+%s", i+1, i+1, withNewline(line), withNewline(fixed))
+		lines[i] = fixed
+	}
+	if !changed || *dryRun {
+		return nil
+	}
+	return ioutil.WriteFile(file, []byte(strings.Join(lines, "")), 0666)
+}
+
+// fixHref returns the href attribute attr, on the page at pageURL, with
+// its link fixed if it's one of fixes.
+func fixHref(attr string, pageURL *url.URL, fixes map[string]linkFix) string {
+	m := hrefRx.FindStringSubmatchIndex(attr)
+	quoted := attr[m[2]:m[3]]
+	raw := html.UnescapeString(quoted[1 : len(quoted)-1])
+	ref, err := pageURL.Parse(raw)
+	if err != nil {
+		return attr
+	}
+	normalizeHost(ref)
+	withoutFrag := *ref
+	withoutFrag.Fragment, withoutFrag.RawFragment = "", ""
+	var fixed string
+	if fix, ok := fixes[withoutFrag.String()+"#"+fragKey(ref.Fragment)]; ok && ref.Fragment != "" && fix.frag != "" {
+		fixed = raw[:strings.Index(raw, "#")+1] + fix.frag
+	} else if fix, ok := fixes[withoutFrag.String()]; ok && fix.url != "" {
+		target, err := url.Parse(fix.url)
+		if err != nil {
+			return attr
+		}
+		if target.Host == pageURL.Host {
+			// Keep the link root-relative rather than spelling out the host.
+			target.Scheme, target.Host = "", ""
+		}
+		if target.Fragment == "" {
+			target.Fragment = ref.Fragment
+		}
+		fixed = target.String()
+	} else {
+		return attr
+	}
+	q := quoted[:1]
+	return attr[:m[2]] + q + html.EscapeString(fixed) + q + attr[m[3]:]
+}
+
+func withNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
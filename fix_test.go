@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFixEscapedFragment checks that -fix finds a link to a missing
+// fragment written escaped and in another case than its problem, with
+// -ignore-case-fragments.
+func TestFixEscapedFragment(t *testing.T) {
+	defer func(old bool) { *ignoreCaseFrags = old }(*ignoreCaseFrags)
+	*ignoreCaseFrags = true
+	var err error
+	if base, err = url.Parse("http://example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	reset()
+	dir, err := ioutil.TempDir("", "linkcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	page := `<a href="/guide.html#Caf%C3%A9-Menu">menu</a>` + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(page), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	data := reportData{Problems: []problem{{
+		Kind:       kindFragment,
+		URL:        "http://example.com/guide.html",
+		Frag:       fragment("Caf%C3%A9-Menu"),
+		Sources:    []string{"http://example.com/"},
+		Suggestion: "cafe-menu",
+	}}}
+	var diff bytes.Buffer
+	if err := fixLinks(dir, data, &diff); err != nil {
+		t.Fatal(err)
+	}
+	if want := `+<a href="/guide.html#cafe-menu">menu</a>`; !strings.Contains(diff.String(), want) {
+		t.Errorf("diff:\n%s\nwant the line %s", diff.String(), want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var checkFootnotes = flag.Bool("check-footnotes", false, "check that each page's footnotes (ids like fn1 or fn:1) are referenced, and that its footnote references and back-references (fnref1) resolve")
+
+// footnoteRx matches the footnote and footnote reference ids generated by
+// Markdown processors: fn1 and fnref1 (Pandoc), fn:1 and fnref:1
+// (kramdown, goldmark, Python-Markdown), and fn-1 and fnref-1.
+var footnoteRx = regexp.MustCompile(`^fn(ref)?(?:[:_-]\w+|\d+)$`)
+
+// checkPageFootnotes reports footnotes on the page at pageURL, parsed into
+// doc, that aren't linked to, and links within the page to footnotes or
+// footnote references that don't exist.
+func checkPageFootnotes(pageURL string, doc *html.Node) {
+	ids := make(map[string]bool)
+	linked := make(map[string]bool)
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if id := attr(n, "id"); id != "" {
+				ids[fragKey(id)] = true
+			}
+			if isAnchor(n) {
+				if ref, ok := href(n); ok && strings.HasPrefix(ref, "#") {
+					linked[fragment(ref[1:])] = true
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	var errs []string
+	for id := range ids {
+		if m := footnoteRx.FindStringSubmatch(id); m != nil && m[1] == "" && !linked[id] {
+			errs = append(errs, fmt.Sprintf("footnote #%s is never referenced", id))
+		}
+	}
+	for frag := range linked {
+		m := footnoteRx.FindStringSubmatch(frag)
+		switch {
+		case m == nil || ids[frag]:
+		case m[1] == "":
+			errs = append(errs, fmt.Sprintf("footnote reference to missing footnote #%s", frag))
+		default:
+			errs = append(errs, fmt.Sprintf("footnote back-reference to missing reference #%s", frag))
+		}
+	}
+	sort.Strings(errs)
+	for _, e := range errs {
+		addProblem(kindFootnote, pageURL, e)
+	}
+}
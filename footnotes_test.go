@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestFootnoteRx(t *testing.T) {
+	tests := []struct {
+		id       string
+		footnote bool
+		ref      bool
+	}{
+		{"fn1", true, false},
+		{"fnref1", true, true},
+		{"fn:1", true, false},
+		{"fnref:note", true, true},
+		{"fn-1", true, false},
+		{"fn_a", true, false},
+		{"fname", false, false},
+		{"fnord", false, false},
+		{"fnrefs", false, false},
+		{"fn", false, false},
+	}
+	for _, tt := range tests {
+		m := footnoteRx.FindStringSubmatch(tt.id)
+		if footnote := m != nil; footnote != tt.footnote || footnote && (m[1] != "") != tt.ref {
+			t.Errorf("footnoteRx on %q: %q, want footnote %v, reference %v", tt.id, m, tt.footnote, tt.ref)
+		}
+	}
+}
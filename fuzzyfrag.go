@@ -0,0 +1,61 @@
+package main
+
+import "flag"
+
+var fuzzyFragments = flag.Bool("fuzzy-fragment-suggestions", false, "for each missing fragment, suggest the most similar id on the page, for typos like #instalation")
+
+// idsByPage returns the ids on each page crawled for them.
+func idsByPage() map[string][]string {
+	ids := make(map[string][]string)
+	for uf, ok := range fragExists {
+		if ok {
+			ids[uf.url] = append(ids[uf.url], uf.frag)
+		}
+	}
+	return ids
+}
+
+// closestID returns the id in ids closest to frag, if it's close enough to
+// be a likely typo, or "".
+func closestID(frag string, ids []string) string {
+	best, bestDist := "", -1
+	for _, id := range ids {
+		if d := editDistance(frag, id); bestDist < 0 || d < bestDist || d == bestDist && id < best {
+			best, bestDist = id, d
+		}
+	}
+	// Allow a couple of edits, but not so many the suggestion is just
+	// another short id.
+	if bestDist < 1 || bestDist > 2 || 2*bestDist > len([]rune(frag)) {
+		return ""
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			d := prev[j-1] // substitution
+			if ra[i-1] != rb[j-1] {
+				d++
+			}
+			if prev[j]+1 < d { // deletion
+				d = prev[j] + 1
+			}
+			if cur[j-1]+1 < d { // insertion
+				d = cur[j-1] + 1
+			}
+			cur[j] = d
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+var harFile = flag.String("har", "", "check the URLs a browser requested, including those loaded by JavaScript, as recorded in this HAR (HTTP Archive) file, instead of crawling from -root")
+
+// A harLog is the part of a HAR file we read.
+type harLog struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// checkHAR checks, without crawling, the distinct http and https URLs of
+// the GET requests in the -har file that aren't excluded.
+func checkHAR(file string) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("reading HAR file: %v", err)
+	}
+	var har harLog
+	if err := json.Unmarshal(b, &har); err != nil {
+		log.Fatalf("reading HAR file %s: %v", file, err)
+	}
+	seen := make(map[string]bool)
+	for _, e := range har.Log.Entries {
+		u := e.Request.URL
+		if i := strings.Index(u, "#"); i >= 0 {
+			u = u[:i]
+		}
+		if e.Request.Method != "GET" || seen[u] || !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			continue
+		}
+		seen[u] = true
+		u, err := parseUrl(u)
+		if err != nil {
+			continue
+		}
+		if why := exclusion(u); why != "" {
+			if *verbose {
+				log.Printf("excluding %s by %s", u, why)
+			}
+			continue
+		}
+		crawlAsset(u, "")
+	}
+	if *verbose {
+		log.Printf("%d URLs from %s", len(seen), file)
+	}
+}
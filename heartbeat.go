@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+var heartbeatFile = flag.String("heartbeat-file", "", "touch this file every few seconds while crawling, so a supervisor can tell a hung crawl from a long one by its modification time")
+
+// heartbeatInterval is how often the -heartbeat-file is touched.
+const heartbeatInterval = 5 * time.Second
+
+// startHeartbeat touches the -heartbeat-file now and every
+// heartbeatInterval until the returned func is called.
+func startHeartbeat() (stop func()) {
+	if *heartbeatFile == "" {
+		return func() {}
+	}
+	touch(*heartbeatFile)
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(heartbeatInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				touch(*heartbeatFile)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// touch sets file's modification time to now, creating it if need be.
+func touch(file string) {
+	now := time.Now()
+	err := os.Chtimes(file, now, now)
+	if os.IsNotExist(err) {
+		var f *os.File
+		if f, err = os.Create(file); err == nil {
+			err = f.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("touching -heartbeat-file: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+	"sync"
+)
+
+var maxConcurrentHosts = flag.Int("max-concurrent-hosts", 0, "maximum number of distinct hosts to fetch from at once, to bound open connections on crawls of links to very many hosts (0 means no limit)")
+
+var (
+	hostsMu     sync.Mutex
+	hostsFree   = sync.NewCond(&hostsMu)
+	activeHosts = make(map[string]int) // host -> fetches from it in progress
+)
+
+// admitHost waits until rawurl's host may be fetched from under
+// -max-concurrent-hosts, and returns a func to call when done. A host
+// already being fetched from is admitted at once.
+func admitHost(rawurl string) (release func()) {
+	if *maxConcurrentHosts <= 0 {
+		return func() {}
+	}
+	var host string
+	if u, err := url.Parse(rawurl); err == nil {
+		host = u.Host
+	}
+	hostsMu.Lock()
+	for activeHosts[host] == 0 && len(activeHosts) >= *maxConcurrentHosts {
+		hostsFree.Wait()
+	}
+	activeHosts[host]++
+	hostsMu.Unlock()
+	return func() {
+		hostsMu.Lock()
+		if activeHosts[host]--; activeHosts[host] == 0 {
+			delete(activeHosts, host)
+			hostsFree.Broadcast()
+		}
+		hostsMu.Unlock()
+	}
+}
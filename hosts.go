@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var (
+	listExternalHosts  = flag.Bool("list-external-hosts", false, "list the external hosts contacted and the number of links to each, for auditing third-party dependencies")
+	reportExternalHTTP = flag.Bool("report-external-without-https", false, "list the external links using http rather than https, by host, whatever the scheme of the pages linking to them")
+)
+
+// A hostCount is an external host and the number of links to it, listed
+// with -list-external-hosts.
+type hostCount struct {
+	Host  string `json:"host"`
+	Links int    `json:"links"`
+}
+
+// externalHosts returns the external hosts of the URLs crawled, sorted by
+// the number of links to them, most first. It's called once the crawl is
+// done.
+func externalHosts() []hostCount {
+	counts := make(map[string]int)
+	for ref, srcs := range linkSources {
+		page := ref
+		if i := strings.Index(page, "#"); i >= 0 {
+			page = page[:i]
+		}
+		if !isCrawled(page) || isInternal(page) {
+			continue
+		}
+		u, err := url.Parse(page)
+		if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+		counts[u.Hostname()] += len(srcs)
+	}
+	hosts := make([]hostCount, 0, len(counts))
+	for h, n := range counts {
+		hosts = append(hosts, hostCount{h, n})
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Links != hosts[j].Links {
+			return hosts[i].Links > hosts[j].Links
+		}
+		return hosts[i].Host < hosts[j].Host
+	})
+	return hosts
+}
+
+// An insecureHost is an external host and the http links to it, listed
+// with -report-external-without-https.
+type insecureHost struct {
+	Host string   `json:"host"`
+	URLs []string `json:"urls"`
+}
+
+// insecureExternalHosts returns the hosts of the external http links
+// found, sorted, with their links. It's called once the crawl is done.
+func insecureExternalHosts() []insecureHost {
+	links := make(map[string]map[string]bool) // host -> http links to it
+	for ref := range linkSources {
+		page := ref
+		if i := strings.Index(page, "#"); i >= 0 {
+			page = page[:i]
+		}
+		if isInternal(page) {
+			continue
+		}
+		u, err := url.Parse(page)
+		if err != nil || u.Scheme != "http" {
+			continue
+		}
+		h := u.Hostname()
+		if links[h] == nil {
+			links[h] = make(map[string]bool)
+		}
+		links[h][page] = true
+	}
+	hosts := make([]insecureHost, 0, len(links))
+	for h, pages := range links {
+		ih := insecureHost{Host: h}
+		for p := range pages {
+			ih.URLs = append(ih.URLs, p)
+		}
+		sort.Strings(ih.URLs)
+		hosts = append(hosts, ih)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Host < hosts[j].Host })
+	return hosts
+}
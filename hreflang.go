@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var checkHreflang = flag.Bool("check-hreflang", false, `check the language variants declared with <link rel="alternate" hreflang>, and warn about variants that don't declare the page as an alternate in return`)
+
+// hreflangs maps each page crawled with -check-hreflang to the hreflang
+// alternates it declares, by URL. Pages without any are included, as they
+// can't reciprocate. It's guarded by mu.
+var hreflangs = make(map[string]map[string]string)
+
+// hreflangRef returns the URL and language of n if it's an hreflang
+// alternate.
+func hreflangRef(n *html.Node) (ref, lang string, ok bool) {
+	if !isLinkRel(n, "alternate") {
+		return "", "", false
+	}
+	lang = strings.TrimSpace(attr(n, "hreflang"))
+	if lang == "" {
+		return "", "", false
+	}
+	ref, valid := cleanHref(attr(n, "href"))
+	if !valid || ref == "" {
+		return "", "", false
+	}
+	return ref, lang, true
+}
+
+func noteHreflangs(pageURL string, alternates map[string]string) {
+	mu.Lock()
+	hreflangs[pageURL] = alternates
+	mu.Unlock()
+}
+
+// checkHreflangs warns about the hreflang alternates that were crawled
+// but don't declare the page linking to them as an alternate, once the
+// crawl is done. Broken alternates are reported like any broken link.
+func checkHreflangs() {
+	for page, alternates := range hreflangs {
+		var missing []string
+		for alt, lang := range alternates {
+			if alt == page {
+				continue
+			}
+			if back, ok := hreflangs[alt]; ok {
+				if _, ok := back[page]; !ok {
+					missing = append(missing, fmt.Sprintf("%s (%s)", alt, lang))
+				}
+			}
+		}
+		sort.Strings(missing)
+		for _, alt := range missing {
+			addWarning(page, "hreflang alternate "+alt+" doesn't link back")
+		}
+	}
+}
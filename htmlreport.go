@@ -0,0 +1,67 @@
+package main
+
+import (
+	"html/template"
+	"io"
+)
+
+// A sourceGroup is a page and the broken links on it, in -format=html.
+type sourceGroup struct {
+	Source   string // "" for problems not linked from any page
+	Problems []problem
+}
+
+// writeHTML writes the -format=html report: a self-contained page of the
+// broken links grouped by the page linking to them, for sharing with
+// people who'd rather not read the text report.
+func writeHTML(w io.Writer, data reportData) error {
+	groups, srcs := bySource(data.Problems)
+	v := struct {
+		reportData
+		Groups []sourceGroup
+	}{reportData: data}
+	for _, src := range srcs {
+		v.Groups = append(v.Groups, sourceGroup{src, groups[src]})
+	}
+	return htmlReport.Execute(w, v)
+}
+
+var htmlReport = template.Must(template.New("html").Funcs(template.FuncMap{"target": problem.target, "statuses": statusSummary}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Link check report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+li { margin: 0.25em 0; }
+.err { color: #a00; }
+</style>
+</head>
+<body>
+<h1>Link check report</h1>
+<p>{{len .Problems}} errors{{if .Suppressed}} ({{.Suppressed}} more suppressed){{end}}, {{len .Warnings}} warnings{{if .Known}}, {{len .Known}} known errors{{end}}. Checked {{.Checked}} URLs, downloaded {{.Bytes}} bytes.</p>
+{{- if .Statuses}}
+<p>Responses: {{statuses .Statuses}}</p>
+{{- end}}
+{{- if .Stopped}}
+<p>The crawl was stopped early.</p>
+{{- end}}
+{{- range .Groups}}
+<h2>{{if .Source}}<a href="{{.Source}}">{{.Source}}</a>{{else}}Not linked from any page{{end}}</h2>
+<ul>
+{{- range .Problems}}
+<li><a href="{{target .}}">{{target .}}</a>: <span class="err">{{.Err}}</span>{{if .Archive}} (<a href="{{.Archive}}">archived copy</a>){{end}}{{if .Suggestion}} (did you mean #{{.Suggestion}}?){{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Warnings}}
+<h2>Warnings</h2>
+<ul>
+{{- range .Warnings}}
+<li><a href="{{.URL}}">{{.URL}}</a>: {{.Err}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
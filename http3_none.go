@@ -0,0 +1,14 @@
+//go:build !http3
+// +build !http3
+
+package main
+
+import "net/http"
+
+// http3Supported is false unless linkcheck is built with -tags http3,
+// which pulls in a QUIC implementation.
+const http3Supported = false
+
+func withHTTP3(fallback http.RoundTripper) http.RoundTripper {
+	return fallback
+}
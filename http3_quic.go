@@ -0,0 +1,71 @@
+//go:build http3
+// +build http3
+
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Supported is true when linkcheck is built with -tags http3.
+const http3Supported = true
+
+// An http3Transport makes https requests over HTTP/3, falling back to
+// another transport (usually HTTP/2) for hosts that don't speak it.
+type http3Transport struct {
+	h3       *http3.Transport
+	fallback http.RoundTripper
+
+	mu      sync.Mutex
+	noHTTP3 map[string]bool // hosts whose HTTP/3 request failed
+}
+
+// withHTTP3 returns a transport trying HTTP/3 before fallback, with the
+// TLS configuration of fallback if it's an *http.Transport.
+func withHTTP3(fallback http.RoundTripper) http.RoundTripper {
+	var tlsConfig *tls.Config
+	if t, ok := fallback.(*http.Transport); ok && t.TLSClientConfig != nil {
+		tlsConfig = t.TLSClientConfig.Clone()
+	}
+	return &http3Transport{
+		h3: &http3.Transport{
+			TLSClientConfig: tlsConfig,
+			// Don't wait long on hosts that ignore QUIC.
+			QUICConfig: &quic.Config{HandshakeIdleTimeout: 3 * time.Second},
+		},
+		fallback: fallback,
+		noHTTP3:  make(map[string]bool),
+	}
+}
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	skip := req.URL.Scheme != "https" || t.noHTTP3[req.URL.Host]
+	t.mu.Unlock()
+	if skip {
+		return t.fallback.RoundTrip(req)
+	}
+	res, err := t.h3.RoundTrip(req)
+	if err == nil {
+		return res, nil
+	}
+	if *verbose {
+		log.Printf("HTTP/3 to %s failed, falling back: %v", req.URL.Host, err)
+	}
+	t.mu.Lock()
+	t.noHTTP3[req.URL.Host] = true
+	t.mu.Unlock()
+	if req.GetBody != nil {
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.fallback.RoundTrip(req)
+}
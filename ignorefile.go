@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var ignoreFile = flag.String("ignore-file", ".linkcheckignore", "file of gitignore-style patterns of paths on the root's site to skip, as with -exclude; it's fine for the default file not to exist")
+
+// An ignoreRule is a pattern from the -ignore-file.
+type ignoreRule struct {
+	pattern string // as written in the file
+	rx      *regexp.Regexp
+	negate  bool // a "!" pattern, re-including paths
+	dirOnly bool // a pattern ending in "/", only matching directories
+}
+
+var ignoreRules []ignoreRule
+
+// loadIgnoreFile reads the patterns from file. If the file is the default
+// .linkcheckignore and doesn't exist there are no patterns.
+func loadIgnoreFile(file string) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) && !flagSet("ignore-file") {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseIgnoreRule(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		ignoreRules = append(ignoreRules, rule)
+	}
+	return s.Err()
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parseIgnoreRule compiles a gitignore pattern. As in git, a pattern with
+// a slash other than a trailing one is relative to the root; otherwise it
+// matches at any depth. "*" and "?" don't match a slash, and "**" matches
+// any number of path segments.
+func parseIgnoreRule(pattern string) (ignoreRule, error) {
+	rule := ignoreRule{pattern: pattern}
+	switch {
+	case strings.HasPrefix(pattern, "!"):
+		rule.negate = true
+		pattern = pattern[1:]
+	case strings.HasPrefix(pattern, `\!`), strings.HasPrefix(pattern, `\#`):
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return rule, fmt.Errorf("empty pattern")
+	}
+
+	var rx strings.Builder
+	rx.WriteString("^")
+	if !anchored {
+		rx.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			rx.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			rx.WriteString(".*")
+			i++
+		case c == '*':
+			rx.WriteString("[^/]*")
+		case c == '?':
+			rx.WriteString("[^/]")
+		case c == '[':
+			j := strings.IndexByte(pattern[i+1:], ']')
+			if j < 0 {
+				return rule, fmt.Errorf("unclosed [ in %q", pattern)
+			}
+			class := pattern[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			rx.WriteString("[" + class + "]")
+			i += j + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			rx.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			rx.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	rx.WriteString("$")
+	var err error
+	rule.rx, err = regexp.Compile(rx.String())
+	return rule, err
+}
+
+// ignoringRule returns the -ignore-file rule ignoring ref, or nil if ref
+// isn't on the root's site or its path, relative to the root, isn't
+// ignored. A path is matched if it or any directory above it matches a
+// pattern, and the last matching pattern wins, so unlike in git "!" can
+// re-include a path in an ignored directory.
+func ignoringRule(ref string) *ignoreRule {
+	if len(ignoreRules) == 0 || !isInternal(ref) {
+		return nil
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil
+	}
+	p := strings.TrimPrefix(strings.TrimPrefix(u.Path, base.Path), "/")
+	if p == "" {
+		return nil
+	}
+	isDir := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+
+	// The directories above p, and p itself.
+	var dirs []string
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' {
+			dirs = append(dirs, p[:i])
+		}
+	}
+	if isDir {
+		dirs = append(dirs, p)
+	}
+
+	var last *ignoreRule
+	for i, r := range ignoreRules {
+		match := !r.dirOnly && r.rx.MatchString(p)
+		for _, d := range dirs {
+			match = match || r.rx.MatchString(d)
+		}
+		if match {
+			last = &ignoreRules[i]
+		}
+	}
+	if last == nil || last.negate {
+		return nil
+	}
+	return last
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+
+	"golang.org/x/net/html"
+)
+
+var checkImages = flag.Bool("check-images", false, "also check <img> sources, and decode GIF, JPEG, and PNG responses to verify they're valid images of their Content-Type")
+
+func isImage(n *html.Node) bool {
+	return n.Type == html.ElementNode && n.Data == "img"
+}
+
+// decodedImageTypes are the Content-Types whose images -check-images
+// decodes.
+var decodedImageTypes = map[string]bool{
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+}
+
+// checkImage decodes the header of the image in r, reporting a problem
+// if it isn't a valid, non-empty image of the given Content-Type. Types
+// it can't decode, such as SVG, aren't checked.
+func checkImage(url, contentType string, r io.Reader) {
+	ct, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !decodedImageTypes[ct] {
+		return
+	}
+	cfg, format, err := image.DecodeConfig(r)
+	switch {
+	case err != nil:
+		addProblem(kindImage, url, fmt.Sprintf("corrupt image: %v", err))
+	case "image/"+format != ct:
+		addProblem(kindImage, url, fmt.Sprintf("corrupt image: %s data served as %s", format, ct))
+	case cfg.Width == 0 || cfg.Height == 0:
+		addProblem(kindImage, url, fmt.Sprintf("corrupt image: %dx%d pixels", cfg.Width, cfg.Height))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"mime"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var checkJSONLD = flag.Bool("check-jsonld", false, `also check (but don't crawl) the URLs in <script type="application/ld+json"> structured data, such as "url", "sameAs", "image", and "logo", on which rich search results depend`)
+
+// jsonldURLKeys are the JSON-LD properties whose values are URLs.
+var jsonldURLKeys = map[string]bool{
+	"url":              true,
+	"sameAs":           true,
+	"image":            true,
+	"logo":             true,
+	"thumbnailUrl":     true,
+	"contentUrl":       true,
+	"embedUrl":         true,
+	"mainEntityOfPage": true,
+}
+
+// isJSONLD reports whether n is a JSON-LD <script>.
+func isJSONLD(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data != "script" {
+		return false
+	}
+	mt, _, _ := mime.ParseMediaType(attr(n, "type"))
+	return mt == "application/ld+json"
+}
+
+// jsonldRefs returns the URLs given for the jsonldURLKeys in the JSON-LD
+// <script> n, at any depth.
+func jsonldRefs(n *html.Node) ([]string, error) {
+	var text strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			text.WriteString(c.Data)
+		}
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(text.String()), &v); err != nil {
+		return nil, err
+	}
+	var refs []string
+	var walk func(v interface{}, isURL bool)
+	walk = func(v interface{}, isURL bool) {
+		switch v := v.(type) {
+		case string:
+			if ref, ok := cleanHref(v); isURL && ok && ref != "" {
+				refs = append(refs, ref)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(v[k], jsonldURLKeys[k])
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e, isURL)
+			}
+		}
+	}
+	walk(v, false)
+	return refs, nil
+}
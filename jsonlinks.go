@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	checkJSONLinks = flag.Bool("check-json-links", false, "also follow the http(s) URLs in internal JSON responses, for sites whose links come from a JSON API")
+	jsonPath       = flag.String("json-path", "", `with -check-json-links, only follow the URLs selected by this path, e.g. "$.items[*].url" (".*" or "[*]" matches every member, "[n]" an array element)`)
+)
+
+// jsonSteps is the compiled -json-path, nil to follow every URL.
+var jsonSteps []string
+
+// compileJSONPath parses a -json-path into its steps: member names, array
+// indexes as "[n]", and "*".
+func compileJSONPath(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("-json-path %q must start with $", p)
+	}
+	var steps []string
+	rest := p[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			rest = rest[1:]
+			i := strings.IndexAny(rest, ".[")
+			if i < 0 {
+				i = len(rest)
+			}
+			if i == 0 {
+				return nil, fmt.Errorf("-json-path %q has an empty member name", p)
+			}
+			steps, rest = append(steps, rest[:i]), rest[i:]
+		case rest[0] == '[':
+			i := strings.IndexByte(rest, ']')
+			if i < 0 {
+				return nil, fmt.Errorf("-json-path %q has an unclosed [", p)
+			}
+			idx := rest[1:i]
+			if idx == "*" {
+				steps = append(steps, "*")
+			} else if _, err := strconv.Atoi(idx); err == nil {
+				steps = append(steps, "["+idx+"]")
+			} else {
+				return nil, fmt.Errorf("-json-path %q: bad index %q", p, idx)
+			}
+			rest = rest[i+1:]
+		default:
+			return nil, fmt.Errorf("-json-path %q: unexpected %q", p, rest)
+		}
+	}
+	return steps, nil
+}
+
+// isJSON reports whether ct is a JSON content type, such as
+// application/json or application/ld+json.
+func isJSON(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	return err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json"))
+}
+
+// jsonLinks returns the http(s) URLs among the strings in the JSON
+// document data: those selected by the -json-path, or all of them.
+func jsonLinks(data []byte) ([]string, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %v", err)
+	}
+	var links []string
+	seen := make(map[string]bool)
+	var walk func(v interface{}, steps []string)
+	walk = func(v interface{}, steps []string) {
+		// Without a -json-path every value is walked.
+		all := jsonSteps == nil
+		if !all && len(steps) == 0 {
+			if s, ok := v.(string); ok && isHTTPURL(s) && !seen[s] {
+				seen[s] = true
+				links = append(links, s)
+			}
+			return
+		}
+		step := "*"
+		if !all {
+			step, steps = steps[0], steps[1:]
+		}
+		switch v := v.(type) {
+		case string:
+			if all && isHTTPURL(v) && !seen[v] {
+				seen[v] = true
+				links = append(links, v)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if step == "*" || step == k {
+					walk(v[k], steps)
+				}
+			}
+		case []interface{}:
+			for i, e := range v {
+				if step == "*" || step == "["+strconv.Itoa(i)+"]" {
+					walk(e, steps)
+				}
+			}
+		}
+	}
+	walk(v, jsonSteps)
+	return links, nil
+}
+
+func isHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
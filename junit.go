@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// A junitSuite is the testsuite in -format=junit output.
+type junitSuite struct {
+	XMLName  xml.Name `xml:"testsuite"`
+	Name     string   `xml:"name,attr"`
+	Tests    int      `xml:"tests,attr"`
+	Failures int      `xml:"failures,attr"`
+	Skipped  int      `xml:"skipped,attr"`
+
+	Properties []junitProperty `xml:"properties>property,omitempty"` // the response counts
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"` // the URL's host, so CI UIs group tests by site
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"` // a known problem, from the -baseline
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes a JUnit XML test case for each crawled URL, failing
+// if it has problems, like writeTAP. Known problems are skipped tests.
+func writeJUnit(w io.Writer, data reportData) error {
+	byURL := make(map[string][]problem)
+	for _, p := range data.Problems {
+		byURL[p.URL] = append(byURL[p.URL], p)
+	}
+	knownByURL := make(map[string][]problem)
+	for _, p := range data.Known {
+		knownByURL[p.URL] = append(knownByURL[p.URL], p)
+	}
+	suite := junitSuite{Name: "linkcheck"}
+	add := func(name string, failed, known []problem) {
+		c := junitCase{Name: name, ClassName: name}
+		if u, err := url.Parse(name); err == nil && u.Host != "" {
+			c.ClassName = u.Host
+		}
+		switch {
+		case len(failed) > 0:
+			c.Failure = junitFailure(failed)
+			suite.Failures++
+		case len(known) > 0:
+			c.Skipped = junitFailure(known)
+			c.Skipped.Message = "known: " + c.Skipped.Message
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	crawledURLs := make(map[string]bool)
+	sort.Slice(data.Results, func(i, j int) bool { return data.Results[i].URL < data.Results[j].URL })
+	for _, r := range data.Results {
+		crawledURLs[r.URL] = true
+		add(r.URL, byURL[r.URL], knownByURL[r.URL])
+	}
+	for _, p := range data.Problems {
+		if !crawledURLs[p.URL] {
+			add(p.target(), []problem{p}, nil)
+		}
+	}
+	for _, p := range data.Known {
+		if !crawledURLs[p.URL] {
+			add(p.target(), nil, []problem{p})
+		}
+	}
+	suite.Tests = len(suite.Cases)
+	if len(data.Statuses) > 0 {
+		suite.Properties = []junitProperty{{"responses", statusSummary(data.Statuses)}}
+	}
+
+	b, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, b)
+	return err
+}
+
+// junitFailure describes problems in a JUnit failure: the errors on one
+// line as the message, and each with the pages linking to it as the text.
+func junitFailure(problems []problem) *junitMessage {
+	var lines []string
+	for _, p := range problems {
+		lines = append(lines, p.String())
+	}
+	return &junitMessage{Message: tapErrors(problems), Text: strings.Join(lines, "\n")}
+}
@@ -11,66 +11,378 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode"
 
+	"github.com/andybalholm/cascadia"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
 )
 
 var (
 	root     = flag.String("root", "http://localhost:8000", "Root to crawl")
 	verbose  = flag.Bool("verbose", false, "verbose")
 	crawlers = flag.Int("crawlers", runtime.NumCPU(), "number of concurrent crawlers")
+
+	homepageRedirect = flag.Bool("homepage-redirect-is-broken", false, "report links redirecting to the root, or external links redirecting to their site's home page, as broken: the page they linked to is likely gone")
+
+	urlDeadline = flag.Duration("url-deadline", 0, "maximum time to spend on each URL, including retries and reading the body (0 means no limit)")
+
+	printCrawlOrder = flag.Bool("print-crawl-order", false, "log each URL, numbered, as a crawler takes it from the queue, for debugging")
+	singleThreaded  = flag.Bool("single-threaded", false, "crawl one URL at a time in the order they're found, so runs are reproducible, for debugging")
+	strategy        = flag.String("strategy", "bfs", `order to crawl in with -single-threaded: "bfs", breadth-first, or "dfs", depth-first, following each page's links before the rest of the queue, to reach deep pages sooner`)
+
+	externalCrawlers = flag.Int("external-crawlers", 0, "number of concurrent crawlers checking external links, so they can be gentler than the -crawlers of the root's site (0 means the -crawlers check them too)")
+
+	maxErrors     = flag.Int("max-errors", 0, "maximum number of errors to report; further errors are counted but not shown (0 means no limit)")
+	maxErrorsStop = flag.Bool("max-errors-stop", false, "stop crawling once -max-errors errors have been reported")
+
+	allowDowngrade = flag.Bool("allow-insecure-redirect-downgrade", false, "don't report https links that redirect to http")
+	downgradeError = flag.Bool("insecure-redirect-error", false, "report https links that redirect to http as errors rather than warnings")
+
+	checkAssets = flag.Bool("check-assets", false, "also check media sources (<source> and <track> src), anchor ping URLs, and Link header targets of crawled pages")
+
+	excludeFrags = flag.Bool("exclude-check-fragments", false, "fetch excluded internal pages linked with a #fragment to verify the fragment exists")
+
+	trapLimit = flag.Int("trap-limit", 0, "stop crawling internal URLs that differ only in their numbers (page=2, /2017/05/) after this many, as a likely crawl trap (0 means no limit)")
+
+	bearerToken = flag.String("bearer-token", "", "send this token in an Authorization: Bearer header on requests to the root's host")
+
+	authAsWarning = flag.Bool("auth-as-warning", false, "report 401 and 403 responses as warnings rather than errors")
+
+	hostBudget = flag.Int("host-budget", 0, "maximum number of requests to any one external host; further links to it are skipped with a warning (0 means no limit)")
+
+	requireBody = flag.String("require-body-match", "", "report internal pages whose body doesn't match this regexp")
+
+	sample       = flag.Int("sample", 0, "only check the first N links discovered, as a quick smoke test (0 means check all)")
+	sampleRandom = flag.Bool("sample-random", false, "with -sample, consider each page's links in random order")
+	maxQueueSize = flag.Int("max-queue-size", 0, "maximum number of URLs waiting to be crawled; links found while the queue is full are dropped, bounding memory on huge sites (0 means no limit)")
+
+	maxRedirects = flag.Int("max-redirects", 10, "maximum number of redirects to follow from a link; 0 reports redirects as errors instead of following them")
+
+	warnEmptyHref = flag.Bool("warn-empty-href", false, `warn about anchors with placeholder hrefs: "", "#", or "javascript:void(0)"`)
+
+	warnHrefSpace = flag.Bool("warn-href-whitespace", false, "warn about anchors whose hrefs have leading or trailing whitespace, embedded newlines, or control characters")
+
+	linkBudget = flag.Int("link-budget-per-page", 0, "stop extracting links from a page after this many, warning about it, to protect the crawl from pathological pages (0 means no limit)")
+
+	selfLinkThreshold = flag.Int("self-link-threshold", 0, "warn about pages with more than this many links to themselves, a likely template bug (0 means don't warn)")
+
+	maxURLLength = flag.Int("max-url-length", 2000, "skip links longer than this many characters with a warning, rather than fetching them (0 means no limit)")
+
+	warnProtoRelative = flag.Bool("warn-protocol-relative", false, "warn about protocol-relative links (//host/path), which should use an explicit https:")
+
+	normalizeUnicode = flag.Bool("normalize-unicode", false, "compare and fetch URL paths and fragments, and page ids, in Unicode NFC form")
+
+	ignoreCaseFrags = flag.Bool("ignore-case-fragments", false, "match fragments to page ids case-insensitively")
+
+	failEmptyRoot = flag.Bool("fail-on-empty-root", false, "report a root page without links as an error rather than a warning")
+
+	independentSessions = flag.Bool("independent-sessions", false, "give each crawler its own cookie jar, so they act as separate user sessions")
+
+	excludeSelector = flag.String("exclude-selector", "", "CSS selector of elements whose links aren't checked, e.g. \".external-widget\" or \".related a\"")
+
+	pathPrefix = flag.String("path-prefix", "", "prepend this path to root-relative links (/css/style.css) when resolving them, to check a site as it will behave deployed under a subpath")
+
+	reportUnusedIDs = flag.Bool("report-unused-ids", false, "warn about the ids on each page that no link targets, for content audits")
+
+	sqlitePath = flag.String("sqlite", "", "add each crawl's results to this SQLite database, for tracking link health over time (requires building with -tags sqlite)")
+
+	useHTTP3 = flag.Bool("http3", false, "check https links over HTTP/3 (QUIC), falling back to HTTP/2 or 1.1 for hosts without it (requires building with -tags http3)")
+
+	tuiMode = flag.Bool("tui", false, "show the crawl's progress in an interactive terminal UI (requires building with -tags tui)")
+
+	maxDepth = flag.Int("max-depth", -1, "maximum number of links to follow from the root or other starting pages; 0 checks only the starting pages (-1 means no limit)")
+
+	queryDepth = flag.Int("allow-query-crawl-depth", -1, "maximum number of URLs with query strings to follow in a row, to stop faceted navigation exploding; 0 doesn't crawl query URLs (-1 means no limit)")
+
+	reparseEncoding = flag.Bool("reparse-on-encoding", false, "convert pages in other character encodings, as given by the Content-Type header or a <meta charset>, to UTF-8 before reading their links and ids")
+
+	checkQueryLinks = flag.Bool("check-query-links", false, "check internal links with query strings, such as search and filter links, for errors but don't crawl the pages they lead to")
+
+	delay       = flag.Duration("delay", 0, "time each crawler waits between requests")
+	delayJitter = flag.Int("delay-jitter", 0, "randomly vary -delay by up to this percentage either way")
+
+	render = flag.String("render", "", "regexp of page URLs to render in headless Chrome before extracting links (requires building with -tags render)")
+
+	acceptHeader = flag.String("accept-header", "text/html,application/xhtml+xml", "Accept header to send when checking links, so content-negotiated pages are served as HTML; a -header Accept overrides it on the root's host (empty sends none)")
 )
 
 var base *url.URL // the parsed root, used to resolve references
 
-var excludePaths []string
+// excludePaths are URL prefixes that aren't checked or crawled. Prefixes
+// starting with "/" are relative to the root.
+var excludePaths listFlag
 
-var wg sync.WaitGroup        // outstanding fetches
-var urlq = make(chan string) // URLs to crawl
+// excludeHosts are hosts whose links aren't checked.
+var excludeHosts listFlag
+
+// ignoreFragHosts are hosts whose fragments aren't checked.
+var ignoreFragHosts listFlag
+
+// allowFragHosts are external hosts whose fragments are checked.
+var allowFragHosts listFlag
+
+// headers are the -header "Name: value" headers.
+var headers headerFlag
+
+// htmlTypes are the content types parsed as HTML besides text/html.
+var htmlTypes listFlag
+
+func init() {
+	flag.Var(&excludePaths, "exclude", "URL or path prefix to skip; may be repeated or comma-separated")
+	flag.Var(&excludeHosts, "exclude-host", "hosts (and their subdomains) whose links are skipped; may be repeated or comma-separated")
+	flag.Var(&headers, "header", `header to send on requests to the root's host, as "Name: value"; may be repeated`)
+	flag.Var(&allowFragHosts, "allow-fragment-hosts", "external hosts (and their subdomains) whose pages are fetched to check #fragments linked to on them; may be repeated or comma-separated")
+	flag.Var(&ignoreFragHosts, "ignore-fragments-on-hosts", "hosts (and their subdomains) whose links are checked but whose #fragments aren't; may be repeated or comma-separated")
+	flag.Var(&htmlTypes, "html-content-types", "content types besides text/html to parse as HTML, for servers sending nonstandard Content-Type headers; may be repeated or comma-separated")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), exitStatuses)
+	}
+}
+
+// exitStatuses explains the exit statuses, after the flags in the usage
+// text. Keep it in step with the README.
+const exitStatuses = `
+Exit status:
+  0  no broken links
+  1  broken links; with -diff, newly broken links; with -max-failure-rate,
+     more broken URLs than the rate; or an error, such as invalid flags
+  2  invalid command-line syntax
+  3  fewer pages crawled for their links than -min-pages
+`
+
+// isHTMLType reports whether a Content-Type header is text/html or one of
+// the -html-content-types.
+func isHTMLType(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	if mt == "text/html" {
+		return true
+	}
+	for _, t := range htmlTypes {
+		if strings.EqualFold(mt, strings.TrimSpace(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// listFlag is a flag.Value collecting strings from repeated and
+// comma-separated uses of a flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// headerFlag is a flag.Value collecting repeated uses of a flag. Unlike
+// listFlag it doesn't split on commas, which header values may contain.
+type headerFlag []string
+
+func (h *headerFlag) String() string {
+	return strings.Join(*h, "; ")
+}
+
+func (h *headerFlag) Set(s string) error {
+	*h = append(*h, s)
+	return nil
+}
+
+var (
+	renderRx *regexp.Regexp // compiled -render, nil if unset
+	bodyRx   *regexp.Regexp // compiled -require-body-match, nil if unset
+
+	excludeSel cascadia.Selector // compiled -exclude-selector, nil if unset
+)
 
 // urlFrag is a URL and its optional #fragment (without the #)
 type urlFrag struct {
 	url, frag string
 }
 
+// Crawl state.
+//
+// The flags and the variables set from them in main, such as base and
+// renderRx, are read-only once crawling starts. Everything below is shared
+// by the crawlLoop goroutines and is guarded by the mutex declared with
+// it; use the helper functions rather than the maps directly. When more
+// than one mutex is held they're acquired in the order mu, linkSourcesMu,
+// problemsMu; fragExistsMu, mdIDsMu, and robotsMu are never held with
+// another.
+//
+// Once wg.Wait returns in run no crawler is running, so run reads the
+// state without locking. reset clears it all before the next crawl.
+
+var wg sync.WaitGroup        // outstanding fetches, done once their errors are recorded
+var urlq = make(chan string) // URLs to crawl
+var extq = make(chan string) // external URLs to check, with -external-crawlers
+var pending int64            // URLs queued but not yet crawled, updated atomically
+
+// fetched, if set, is called by the crawlers after each URL is crawled,
+// with the error crawling it, if any. It's set before crawling starts.
+var fetched func(url string, err error)
+
 var (
 	mu          sync.Mutex
 	crawled     = make(map[string]bool)      // URL without fragment -> true
+	noRecurse   = make(map[string]bool)      // URL without fragment -> don't follow its links
+	idsOnly     = make(map[string]bool)      // URL without fragment -> only collect its ids
 	neededFrags = make(map[urlFrag][]string) // URL#frag -> who needs it
+	templates   = make(map[string]int)       // urlTemplate -> URLs crawled with it
+	hostCounts  = make(map[string]int)       // external host -> requests made
+	redirects   = make(map[string]int)       // URL without fragment -> redirects followed to reach it
+	depths      = make(map[string]int)       // URL without fragment -> links followed from a seed to reach it
+	rootLinks   = -1                         // links found on the root page, -1 until it's read
+	queryDepths = make(map[string]int)       // URL without fragment -> query URLs linked in a row to reach it
+	pings       = make(map[string]bool)      // URL without fragment -> check with a POST, as an anchor's ping
+	dropped     = make(map[string]bool)      // URL without fragment -> not queued because of -max-queue-size
+	fifo        []string                     // URLs queued, in order, with -single-threaded
 )
 
-// Owned by crawlLoop goroutines:
 var (
-	linkSources   = make(map[string][]string) // url no fragment -> sources
 	linkSourcesMu sync.Mutex
-	fragExists    = make(map[urlFrag]bool)
-	fragExistsMu  sync.Mutex
-	problems      []string
+	linkSources   = make(map[string][]string) // url no fragment -> sources
+)
+
+var (
+	fragExistsMu sync.Mutex
+	fragExists   = make(map[urlFrag]bool)
+)
+
+var (
+	problemsMu  sync.Mutex
+	problems    []problem
+	warnings    []problem    // reported, but don't fail the crawl
+	suppressed  int          // problems not recorded because of -max-errors
+	streamed    int          // problems written as they were found, with -stream-errors
+	stopping    bool         // -max-errors reached with -max-errors-stop, or interrupted
+	interrupted bool         // stopped by a signal
+	results     []pageResult // crawled URLs, with -format=tap or junit, -report-dir, -report-ok, or -sqlite
+	timings     []slowURL    // response times, with -slowest
 )
 
+// unlisted holds the URLs that couldn't be fetched or had a bad status, in
+// problems streamed or suppressed rather than kept. Guarded by problemsMu.
+var unlisted = make(map[string]bool)
+
+var bytesRead int64 // response body bytes downloaded, updated atomically
+
+// countingReader adds the number of bytes read through it to bytesRead,
+// and keeps reads within the -max-bandwidth.
+type countingReader struct {
+	r io.Reader
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&bytesRead, int64(n))
+	throttle(n)
+	return n, err
+}
+
 func isAnchor(n *html.Node) bool {
 	return n.Type == html.ElementNode && n.Data == "a"
 }
 
-func href(n *html.Node) string {
-	for _, attr := range n.Attr {
-		if attr.Key == "href" {
-			return attr.Val
+// isMediaSource reports whether n is a <source> or <track> element, the
+// sources of a <video> or <audio> element.
+func isMediaSource(n *html.Node) bool {
+	return n.Type == html.ElementNode && (n.Data == "source" || n.Data == "track")
+}
+
+// isLinkRel reports whether n is a <link> element with the given rel.
+func isLinkRel(n *html.Node, rel string) bool {
+	if n.Type != html.ElementNode || n.Data != "link" {
+		return false
+	}
+	for _, r := range strings.Fields(attr(n, "rel")) {
+		if strings.EqualFold(r, rel) {
+			return true
 		}
 	}
-	return ""
+	return false
+}
+
+func href(n *html.Node) (string, bool) {
+	return lookupAttr(n, "href")
+}
+
+func attr(n *html.Node, key string) string {
+	val, _ := lookupAttr(n, key)
+	return val
+}
+
+func lookupAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// isPlaceholderHref reports whether ref is an href that goes nowhere,
+// usually left in by mistake.
+func isPlaceholderHref(ref string) bool {
+	switch strings.TrimSpace(ref) {
+	case "", "#", "javascript:void(0)", "javascript:void(0);":
+		return true
+	}
+	return false
+}
+
+// cleanHref returns ref without the leading and trailing whitespace and
+// embedded tabs and newlines that browsers ignore, and whether the rest is
+// free of control characters and so can be fetched.
+func cleanHref(ref string) (string, bool) {
+	clean := strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(ref))
+	return clean, strings.IndexFunc(clean, unicode.IsControl) < 0
 }
 
 var invalidProtos = []string{
@@ -79,47 +391,391 @@ var invalidProtos = []string{
 	"tel:",
 }
 
-func excludeLink(ref string) bool {
+// exclusion returns why ref isn't checked, or "" if it is. A link is
+// excluded if any of these excludes it, and they're tried in this order,
+// which only decides the reason given:
+//
+//   - a scheme in invalidProtos, which can't be checked
+//   - an -exclude-host
+//   - an -exclude prefix
+//   - the -ignore-file patterns
+//   - the host's robots.txt, with -respect-robots-txt
+//
+// The ignore file's "!" patterns only re-include paths its own patterns
+// exclude, not those excluded by flags.
+func exclusion(ref string) string {
 	for _, proto := range invalidProtos {
 		if strings.HasPrefix(ref, proto) {
-			return true
+			return "scheme " + proto
 		}
 	}
+	if h := matchingHost(ref, excludeHosts); h != "" {
+		return "-exclude-host " + h
+	}
+	if why := pathExclusion(ref); why != "" {
+		return why
+	}
+	if *respectRobotsTxt && robotsDisallowed(ref) {
+		return "robots.txt"
+	}
+	return ""
+}
+
+// pathExclusion returns the -exclude prefix or -ignore-file pattern that
+// excludes ref, or "" if none does.
+func pathExclusion(ref string) string {
 	for _, prefix := range excludePaths {
 		if strings.HasPrefix(ref, prefix) {
-			return true
+			return "-exclude " + prefix
 		}
 	}
-	return false
+	if r := ignoringRule(ref); r != nil {
+		return fmt.Sprintf("-ignore-file pattern %q", r.pattern)
+	}
+	return ""
+}
+
+// hostMatches reports whether the host of rawurl is one of hosts or a
+// subdomain of one.
+func hostMatches(rawurl string, hosts []string) bool {
+	return matchingHost(rawurl, hosts) != ""
+}
+
+// matchingHost returns the one of hosts that the host of rawurl is or is
+// a subdomain of, or "" if there isn't one.
+func matchingHost(rawurl string, hosts []string) string {
+	if len(hosts) == 0 {
+		return ""
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		lh := strings.ToLower(h)
+		if host == lh || strings.HasSuffix(host, "."+lh) {
+			return h
+		}
+	}
+	return ""
 }
 
 // parses URL and resolves references
-func parseUrl(ref string) string {
+func parseUrl(ref string) (string, error) {
+	if *pathPrefix != "" && strings.HasPrefix(ref, "/") && !strings.HasPrefix(ref, "//") {
+		ref = strings.TrimSuffix(*pathPrefix, "/") + ref
+	}
 	u, err := url.Parse(ref)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return base.ResolveReference(u).String()
+	u = base.ResolveReference(u)
+	normalizeHost(u)
+	if *normalizeUnicode {
+		u.Path, u.RawPath = nfc(u.Path), ""
+		u.Fragment, u.RawFragment = nfc(u.Fragment), ""
+	}
+	return u.String(), nil
 }
 
-func getLinks(body string) (links []string) {
-	doc, err := html.Parse(strings.NewReader(body))
+// linkURL resolves ref, a link found on the page at pageURL, warning and
+// returning false if it isn't a valid URL. Links come from page content,
+// so they can be anything.
+func linkURL(pageURL, ref string) (string, bool) {
+	u, err := parseUrl(ref)
 	if err != nil {
-		log.Printf("ERROR: parsing HTML: %v", err)
+		addWarning(pageURL, fmt.Sprintf("skipped invalid link %q: %v", ref, err))
+		return "", false
+	}
+	return u, true
+}
+
+// fragment returns the unescaped form of the escaped URL fragment frag,
+// for comparison with page ids.
+func fragment(frag string) string {
+	if f, err := url.PathUnescape(frag); err == nil {
+		frag = f
+	}
+	return fragKey(frag)
+}
+
+// fragKey returns the form of a fragment or page id used to compare them:
+// in NFC with -normalize-unicode, and lowercase with -ignore-case-fragments.
+func fragKey(frag string) string {
+	frag = nfc(frag)
+	if *ignoreCaseFrags {
+		frag = strings.ToLower(frag)
+	}
+	return frag
+}
+
+// nfc returns s in Unicode Normalization Form C with -normalize-unicode,
+// so that visually identical paths and ids compare equal.
+func nfc(s string) string {
+	if !*normalizeUnicode {
+		return s
+	}
+	return norm.NFC.String(s)
+}
+
+// normalizeHost rewrites u's host in lowercase, with any internationalized
+// domain name in its ASCII (punycode) form, so that URLs for the same host
+// compare equal. An empty http(s) path becomes "/".
+func normalizeHost(u *url.URL) {
+	if u.Host == "" {
 		return
 	}
+	host, port := u.Hostname(), u.Port()
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			host = "[" + ip.String() + "]"
+		}
+	} else if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	} else {
+		host = strings.ToLower(host)
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "" && u.Opaque == "" && (u.Scheme == "http" || u.Scheme == "https") {
+		u.Path = "/"
+	}
+}
+
+// isInternal reports whether rawurl is on the site being crawled: it has
+// the same scheme and host as the root, and a path under the root's.
+func isInternal(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	normalizeHost(u)
+	return u.Scheme == base.Scheme && u.Host == base.Host && strings.HasPrefix(u.Path, base.Path)
+}
+
+// parsePage parses the HTML body of the page at pageURL, returning nil if
+// it can't be parsed within the -crawl-budget-time-per-page.
+func parsePage(pageURL, body string) *html.Node {
+	doc, err := parseHTML(body)
+	if err != nil {
+		if errors.Is(err, errParseBudget) {
+			addWarning(pageURL, fmt.Sprintf("skipped: parsing took longer than %v", *parseBudget))
+			return nil
+		}
+		log.Printf("ERROR: parsing HTML: %v", err)
+		return nil
+	}
+	return doc
+}
 
+// getLinks returns the links on the page at pageURL, parsed into doc, to
+// crawl, and the assets on the page (with -check-assets) to check without
+// crawling. It warns about any problems with the page's links.
+func getLinks(pageURL string, doc *html.Node) (links, assets []string) {
 	// TODO(paulsmith): global seen map
 	seen := map[string]bool{}
+	placeholders := map[string]int{} // placeholder href -> anchors using it
+	selfLinks := 0                   // anchors linking to pageURL itself, without a fragment
+	var amp ampLinks
+	alternates := make(map[string]string) // hreflang alternate URL -> language, with -check-hreflang
+
+	// Links in elements matching -exclude-selector aren't followed.
+	excludedNodes := make(map[*html.Node]bool)
+	if excludeSel != nil {
+		for _, m := range excludeSel.MatchAll(doc) {
+			excludedNodes[m] = true
+		}
+	}
 
+	overBudget := false // -link-budget-per-page reached
+	nofollow := false   // a robots <meta> tag says nofollow
 	var f func(*html.Node)
 	f = func(n *html.Node) {
+		if *linkBudget > 0 && len(links)+len(assets) >= *linkBudget {
+			overBudget = true
+			return
+		}
+		if excludedNodes[n] {
+			if *verbose {
+				log.Printf("    excluding links in <%s> matching -exclude-selector", n.Data)
+			}
+			return
+		}
 		if isAnchor(n) {
-			ref := href(n)
-			ref = parseUrl(ref)
-			if !seen[ref] {
-				seen[ref] = true
-				links = append(links, ref)
+			if ref, ok := href(n); ok {
+				if *warnEmptyHref && isPlaceholderHref(ref) {
+					placeholders[ref]++
+				}
+				clean, valid := cleanHref(ref)
+				if *warnHrefSpace && (clean != ref || !valid) {
+					addWarning(pageURL, fmt.Sprintf("href %q contains whitespace or control characters", ref))
+				}
+				if *warnProtoRelative && strings.HasPrefix(clean, "//") {
+					addWarning(pageURL, "protocol-relative link "+clean)
+				}
+				if valid {
+					ref, valid = linkURL(pageURL, clean)
+				}
+				if valid {
+					if ref == pageURL {
+						selfLinks++
+					}
+					if *reportInconsistentAnchors {
+						noteAnchor(linkText(n), ref)
+					}
+					if *checkA11yLinks && !hasAccessibleName(n) {
+						addWarning(pageURL, "link to "+ref+" has no text")
+					}
+					if !seen[ref] {
+						seen[ref] = true
+						links = append(links, ref)
+					}
+				}
+			}
+			if *checkAssets {
+				for _, ref := range strings.Fields(attr(n, "ping")) {
+					if ref, ok := linkURL(pageURL, ref); ok && !seen[ref] {
+						seen[ref] = true
+						notePing(ref)
+						assets = append(assets, ref)
+					}
+				}
+			}
+		}
+		if *respectRobotsMeta && metaNofollow(n) {
+			nofollow = true
+		}
+		if *checkAMP && isAMPDoc(n) {
+			amp.amp = true
+		}
+		if (*canonicalCheck || *checkAMP) && isLinkRel(n, "canonical") ||
+			*checkAMP && isLinkRel(n, "amphtml") {
+			if ref, ok := href(n); ok {
+				if ref, ok := cleanHref(ref); ok {
+					if ref, ok := linkURL(pageURL, ref); ok {
+						switch {
+						case isLinkRel(n, "amphtml"):
+							amp.amphtml = ref
+						case *canonicalCheck:
+							noteCanonical(pageURL, ref)
+							fallthrough
+						default:
+							amp.canonical = ref
+						}
+						if !seen[ref] {
+							seen[ref] = true
+							links = append(links, ref)
+						}
+					}
+				}
+			}
+		}
+		if *checkHreflang {
+			if ref, lang, ok := hreflangRef(n); ok {
+				if ref, ok := linkURL(pageURL, ref); ok {
+					if i := strings.Index(ref, "#"); i >= 0 {
+						ref = ref[:i]
+					}
+					alternates[ref] = lang
+					if !seen[ref] {
+						seen[ref] = true
+						links = append(links, ref)
+					}
+				}
+			}
+		}
+		if *checkSRI {
+			if ref, integrity, ok := sriRef(n); ok {
+				if ref, ok := linkURL(pageURL, ref); ok {
+					noteIntegrity(ref, integrity, pageURL)
+					if !seen[ref] {
+						seen[ref] = true
+						assets = append(assets, ref)
+					}
+				}
+			}
+		}
+		if *checkFeeds {
+			if ref, ok := feedRef(n); ok {
+				if ref, ok := linkURL(pageURL, ref); ok && !seen[ref] {
+					seen[ref] = true
+					links = append(links, ref)
+				}
+			}
+		}
+		if *respectMetaRefresh {
+			if delay, ref, ok := metaRefresh(n); ok {
+				if ref, ok := cleanHref(ref); ok {
+					if ref, ok := linkURL(pageURL, ref); ok {
+						// An immediate refresh is a redirect.
+						if delay == 0 && !redirectHop(pageURL, ref) {
+							addProblem(kindRedirect, pageURL, fmt.Sprintf("too many redirects (more than %d)", *maxRedirects))
+						} else if !seen[ref] {
+							seen[ref] = true
+							links = append(links, ref)
+						}
+					}
+				}
+			}
+		}
+		if *checkSocialMeta {
+			if ref, isImage, ok := socialMetaRef(n); ok {
+				if ref, ok := linkURL(pageURL, ref); ok {
+					if isImage {
+						noteSocialImage(ref)
+					}
+					if !seen[ref] {
+						seen[ref] = true
+						assets = append(assets, ref)
+					}
+				}
+			}
+		}
+		if *checkManifest {
+			if ref, isManifest, ok := iconOrManifest(n); ok {
+				if ref, ok := linkURL(pageURL, ref); ok {
+					if isManifest {
+						noteManifest(ref)
+					}
+					if !seen[ref] {
+						seen[ref] = true
+						assets = append(assets, ref)
+					}
+				}
+			}
+		}
+		if *checkCommentedLinks {
+			for _, ref := range commentedRefs(n) {
+				if ref, ok := linkURL(pageURL, ref); ok && !seen[ref] {
+					seen[ref] = true
+					assets = append(assets, ref)
+				}
+			}
+		}
+		if *checkJSONLD && isJSONLD(n) {
+			refs, err := jsonldRefs(n)
+			if err != nil {
+				addWarning(pageURL, "invalid JSON-LD: "+err.Error())
+			}
+			for _, ref := range refs {
+				if ref, ok := linkURL(pageURL, ref); ok && !seen[ref] {
+					seen[ref] = true
+					assets = append(assets, ref)
+				}
+			}
+		}
+		if *checkAssets && isMediaSource(n) || *checkImages && isImage(n) {
+			if ref, ok := cleanHref(attr(n, "src")); ok && ref != "" {
+				if *warnProtoRelative && strings.HasPrefix(ref, "//") {
+					addWarning(pageURL, "protocol-relative link "+ref)
+				}
+				if ref, ok := linkURL(pageURL, ref); ok && !seen[ref] {
+					seen[ref] = true
+					assets = append(assets, ref)
+				}
 			}
 		}
 
@@ -129,9 +785,61 @@ func getLinks(body string) (links []string) {
 	}
 	f(doc)
 
+	if nofollow {
+		if *verbose {
+			log.Printf("  not following links on %s: robots meta tag nofollow", pageURL)
+		}
+		links = nil
+	}
+	if overBudget {
+		addWarning(pageURL, fmt.Sprintf("stopped extracting links after %d (-link-budget-per-page)", *linkBudget))
+	}
+	for ref, n := range placeholders {
+		addWarning(pageURL, fmt.Sprintf("%d links with placeholder href %q", n, ref))
+	}
+	if *selfLinkThreshold > 0 && selfLinks > *selfLinkThreshold {
+		addWarning(pageURL, fmt.Sprintf("%d links to the page itself", selfLinks))
+	}
+	if *checkAMP {
+		noteAMPLinks(pageURL, amp)
+	}
+	if *checkHreflang {
+		noteHreflangs(pageURL, alternates)
+	}
 	return
 }
 
+// linkHeaderRefs returns the URI references in Link header values, which
+// look like `<uri>; rel=preload; as=style, <uri>; rel="next"` (RFC 8288).
+func linkHeaderRefs(values []string) (refs []string) {
+	for _, v := range values {
+		for {
+			start := strings.IndexByte(v, '<')
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(v[start:], '>')
+			if end < 0 {
+				break
+			}
+			refs = append(refs, v[start+1:start+end])
+			v = v[start+end+1:]
+			// Skip the link's parameters, which may contain quoted commas.
+			quoted := false
+			i := 0
+			for ; i < len(v); i++ {
+				if v[i] == '"' {
+					quoted = !quoted
+				} else if v[i] == ',' && !quoted {
+					break
+				}
+			}
+			v = v[i:]
+		}
+	}
+	return refs
+}
+
 var idRx = regexp.MustCompile(`\bid=['"]?([^\s'">]+)`)
 
 func pageIDs(body string) (ids []string) {
@@ -142,167 +850,1630 @@ func pageIDs(body string) (ids []string) {
 	return
 }
 
+// isCrawled reports whether url, without fragment, has been queued to be
+// crawled. mu must be held.
+func isCrawled(url string) bool {
+	if seenDisk != nil {
+		return seenDisk.has(url)
+	}
+	return crawled[url]
+}
+
+// markCrawled records that url, without fragment, has been queued to be
+// crawled. mu must be held.
+func markCrawled(url string) {
+	if seenDisk != nil {
+		seenDisk.add(url)
+		return
+	}
+	crawled[url] = true
+}
+
+// crawledCount returns the number of URLs queued to be crawled. mu must be
+// held.
+func crawledCount() int {
+	if seenDisk != nil {
+		return seenDisk.len()
+	}
+	return len(crawled)
+}
+
 // url may contain a #fragment, and the fragment is then noted as needing to exist.
 func crawl(url string, sourceURL string) {
 	mu.Lock()
 	defer mu.Unlock()
 	var frag string
 	if i := strings.Index(url, "#"); i >= 0 {
-		frag = url[i+1:]
+		frag = fragment(url[i+1:])
 		url = url[:i]
-		if frag != "" {
-			uf := urlFrag{url, frag}
-			neededFrags[uf] = append(neededFrags[uf], sourceURL)
-		}
 	}
-	if crawled[url] {
+	if !isCrawled(url) && (tooDeep(url, sourceURL) || sampled() || trapped(url) || queueFull(url)) {
+		return
+	}
+	if frag != "" {
+		uf := urlFrag{url, frag}
+		neededFrags[uf] = append(neededFrags[uf], sourceURL)
+	}
+	if isCrawled(url) || stopped() {
+		return
+	}
+	markCrawled(url)
+	if overBudget(url) {
+		addWarning(url, "skipped (host budget exceeded)")
 		return
 	}
-	crawled[url] = true
 
 	wg.Add(1)
-	go func() {
-		urlq <- url
-	}()
-}
+	atomic.AddInt64(&pending, 1)
+	if *singleThreaded {
+		fifo = append(fifo, url)
+		return
+	}
+	if urlDiskq != nil {
+		if *externalCrawlers > 0 && !isInternal(url) {
+			extDiskq.push(url)
+		} else {
+			urlDiskq.push(url)
+		}
+		return
+	}
+	q := urlq
+	if *externalCrawlers > 0 && !isInternal(url) {
+		q = extq
+	}
+	go func() {
+		q <- url
+	}()
+}
+
+// tooDeep reports whether url, linked from sourceURL, is deeper than
+// -max-depth, or is a URL with a query string deeper than
+// -allow-query-crawl-depth, and otherwise records its depths. Must hold
+// mu.
+func tooDeep(url, sourceURL string) bool {
+	d, ok := depths[url]
+	if !ok && sourceURL != "" {
+		d = depths[sourceURL] + 1
+	}
+	if *maxDepth >= 0 && d > *maxDepth {
+		return true
+	}
+	// A URL's query depth is the number of query URLs linked in a row
+	// to reach it, so it's 0 for URLs without a query.
+	qd, ok := queryDepths[url]
+	if !ok && strings.Contains(url, "?") {
+		qd = queryDepths[sourceURL] + 1
+	}
+	if *queryDepth >= 0 && qd > *queryDepth {
+		return true
+	}
+	depths[url] = d
+	queryDepths[url] = qd
+	return false
+}
+
+// sampled reports whether -sample links (plus the root) have already been
+// queued. mu must be held.
+func sampled() bool {
+	return *sample > 0 && crawledCount() > *sample
+}
+
+// queueFull reports whether -max-queue-size URLs are already waiting to
+// be crawled, and if so records url as dropped. mu must be held.
+func queueFull(url string) bool {
+	if *maxQueueSize <= 0 || atomic.LoadInt64(&pending) < int64(*maxQueueSize) {
+		return false
+	}
+	dropped[url] = true
+	return true
+}
+
+// checkDropped warns about the URLs dropped because the queue was full
+// that weren't crawled once it drained.
+func checkDropped() {
+	var urls []string
+	for url := range dropped {
+		if !isCrawled(url) {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		addWarning(url, "not crawled (queue full)")
+	}
+}
+
+var digitsRx = regexp.MustCompile(`[0-9]+`)
+
+// urlTemplate returns internal url with the runs of digits after the root
+// replaced, so that URLs differing only in a counter or date share a
+// template.
+func urlTemplate(url string) string {
+	root := base.String()
+	return root + digitsRx.ReplaceAllString(strings.TrimPrefix(url, root), "N")
+}
+
+// trapped reports whether url, which hasn't been crawled yet, looks like
+// part of a crawl trap: one of more than -trap-limit internal URLs with the
+// same template. It warns when a template first exceeds the limit. mu must
+// be held.
+func trapped(url string) bool {
+	if *trapLimit <= 0 || !isInternal(url) {
+		return false
+	}
+	t := urlTemplate(url)
+	if t == url {
+		return false
+	}
+	templates[t]++
+	if templates[t] <= *trapLimit {
+		return false
+	}
+	if templates[t] == *trapLimit+1 {
+		addWarning(url, fmt.Sprintf("possible crawl trap: more than %d URLs like %s, not crawling any more", *trapLimit, t))
+	}
+	return true
+}
+
+// overBudget counts a request to rawurl, reporting whether it would exceed
+// -host-budget. mu must be held.
+func overBudget(rawurl string) bool {
+	if *hostBudget <= 0 || isInternal(rawurl) {
+		return false
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	if hostCounts[u.Host] >= *hostBudget {
+		return true
+	}
+	hostCounts[u.Host]++
+	return false
+}
+
+// crawlAsset is like crawl, but url is only checked, never parsed for
+// links or ids.
+func crawlAsset(url string, sourceURL string) {
+	if i := strings.Index(url, "#"); i >= 0 {
+		url = url[:i]
+	}
+	mu.Lock()
+	if !isCrawled(url) {
+		noRecurse[url] = true
+	}
+	mu.Unlock()
+	crawl(url, sourceURL)
+}
+
+// notePing records that url is an anchor's ping URL, so it's checked with
+// a POST as browsers send pings, unless it's already been crawled.
+func notePing(url string) {
+	mu.Lock()
+	if !isCrawled(url) {
+		pings[url] = true
+	}
+	mu.Unlock()
+}
+
+// crawlForIDs is like crawl, but url is only fetched to collect its ids;
+// its links aren't followed and failing to fetch it isn't reported (any
+// fragments needed from it will be reported missing instead).
+func crawlForIDs(url string, sourceURL string) {
+	page := url
+	if i := strings.Index(page, "#"); i >= 0 {
+		page = page[:i]
+	}
+	mu.Lock()
+	if !isCrawled(page) {
+		idsOnly[page] = true
+	}
+	mu.Unlock()
+	crawl(url, sourceURL)
+}
+
+// followLink records that sourceURL links to ref and queues ref to be
+// crawled, or only checked if asset is set.
+func followLink(sourceURL, ref string, asset bool) {
+	if *verbose {
+		log.Printf("  links to %s", ref)
+	}
+	if *maxURLLength > 0 && len(ref) > *maxURLLength {
+		addWarning(sourceURL, fmt.Sprintf("skipped %d-character link %.60s...", len(ref), ref))
+		return
+	}
+	if why := exclusion(ref); why != "" {
+		// Exclusion means the link isn't checked and the page isn't
+		// crawled, but with -exclude-check-fragments we still need the
+		// page's ids when it's linked to with a fragment.
+		if *excludeFrags && pathExclusion(ref) != "" && strings.Contains(ref, "#") && isInternal(ref) {
+			if *verbose {
+				log.Printf("    excluding %s by %s, but checking its fragment", ref, why)
+			}
+			crawlForIDs(ref, sourceURL)
+			return
+		}
+		if *verbose {
+			log.Printf("    excluding %s by %s", ref, why)
+		}
+		return
+	}
+	noteLinkSource(ref, sourceURL)
+	noteInsecure(ref)
+	if *dnsWarmup && !isInternal(ref) {
+		warmDNS(ref)
+	}
+	warnPrivate(sourceURL, ref)
+	warnHost(sourceURL, ref)
+	warnCase(sourceURL, ref)
+	if *checkQueryLinks && !asset && isInternal(ref) && hasQuery(ref) {
+		// Query links are checked for server errors without exploring
+		// the combinations of parameters they lead to.
+		asset = true
+	}
+	if asset {
+		crawlAsset(ref, sourceURL)
+	} else {
+		warnQuery(sourceURL, ref)
+		warnSlash(sourceURL, ref)
+		crawl(ref, sourceURL)
+	}
+}
+
+// toUTF8 returns the HTML body of the page at url converted to UTF-8 from
+// the encoding given by its Content-Type ct, or by a <meta> tag.
+func toUTF8(url string, body []byte, ct string) []byte {
+	enc, name, _ := charset.DetermineEncoding(body, ct)
+	if name == "utf-8" {
+		return body
+	}
+	b, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		log.Printf("converting %s from %s: %v", url, name, err)
+		return body
+	}
+	if *verbose {
+		log.Printf("converted %s from %s", url, name)
+	}
+	return b
+}
+
+// hasQuery reports whether ref has a query string.
+func hasQuery(ref string) bool {
+	u, err := url.Parse(ref)
+	return err == nil && u.RawQuery != ""
+}
+
+func noteRootLinks(n int) {
+	mu.Lock()
+	rootLinks = n
+	mu.Unlock()
+}
+
+// noteLinkSource records that sourceURL links to url.
+func noteLinkSource(url, sourceURL string) {
+	linkSourcesMu.Lock()
+	linkSources[url] = append(linkSources[url], sourceURL)
+	linkSourcesMu.Unlock()
+}
+
+// noteNeededFrag records that sourceURL links to the fragment uf.
+func noteNeededFrag(uf urlFrag, sourceURL string) {
+	uf.frag = fragKey(uf.frag)
+	mu.Lock()
+	neededFrags[uf] = append(neededFrags[uf], sourceURL)
+	mu.Unlock()
+}
+
+// noteFragExists records that the fragment uf exists.
+func noteFragExists(uf urlFrag) {
+	uf.frag = fragKey(uf.frag)
+	fragExistsMu.Lock()
+	fragExists[uf] = true
+	fragExistsMu.Unlock()
+}
+
+// crawlMode reports how url, a URL without fragment, should be crawled:
+// checkOnly if its links shouldn't be followed, and onlyIDs if it's only
+// needed for its ids.
+func crawlMode(url string) (checkOnly, onlyIDs bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	checkOnly = noRecurse[url] || changedPages != nil && !changedPages[url]
+	return checkOnly, idsOnly[url]
+}
+
+// sources returns the pages known to link to url.
+func sources(url string) []string {
+	linkSourcesMu.Lock()
+	defer linkSourcesMu.Unlock()
+	return append([]string(nil), linkSources[url]...)
+}
+
+// Kinds of problem.
+const (
+	kindStatus   = "status"   // unexpected HTTP status
+	kindFetch    = "fetch"    // request failed
+	kindRedirect = "redirect" // bad redirect
+	kindFragment = "fragment" // missing fragment
+	kindFile     = "file"     // missing local file
+	kindBody     = "body"     // page content failed validation
+	kindInsecure = "insecure" // http link with -strict-https
+	kindImage    = "image"    // invalid image with -check-images
+	kindAMP      = "amp"      // AMP page and canonical don't link to each other
+	kindSitemap  = "sitemap"  // unreadable -sitemap
+	kindEmpty    = "empty"    // root page without links, with -fail-on-empty-root
+	kindFootnote = "footnote" // unreferenced footnote or broken footnote link, with -check-footnotes
+	kindDownload = "download" // bad range response, with -accept-ranges-check
+
+	kindUnreached = "unreached" // no URL matched a -require-reached regexp
+	kindIntegrity = "integrity" // subresource doesn't match its integrity attribute, with -check-sri
+	kindTransient = "transient" // network error that may not recur, with -retry-later
+)
+
+func addProblem(kind, url, errmsg string) {
+	p := problem{Kind: kind, URL: url, Err: errmsg, Sources: sources(url)}
+	if *verbose {
+		log.Print(p)
+	}
+	recordProblem(p)
+}
+
+// recordProblem adds p to the report, or with -stream-errors writes it
+// out now. Once -max-errors problems have been recorded, further problems
+// are only counted.
+func recordProblem(p problem) {
+	errorsTotal.WithLabelValues(p.Kind).Inc()
+	problemsMu.Lock()
+	defer problemsMu.Unlock()
+	if *maxErrors > 0 && len(problems)+streamed >= *maxErrors {
+		suppressed++
+		noteUnlisted(p)
+		return
+	}
+	// Known problems are kept to be reported with the baseline.
+	if *streamErrors && !(baseline != nil && known(p)) {
+		streamProblem(p)
+		streamed++
+		noteUnlisted(p)
+	} else {
+		problems = append(problems, p)
+	}
+	if *maxErrors > 0 && len(problems)+streamed == *maxErrors && *maxErrorsStop {
+		if *verbose {
+			log.Printf("reached %d errors, stopping crawl", *maxErrors)
+		}
+		stopping = true
+	}
+}
+
+// noteUnlisted records the URL of p, a problem not kept in the report, if
+// it's broken, for -max-failure-rate. problemsMu must be held.
+func noteUnlisted(p problem) {
+	if p.Kind == kindFetch || p.Kind == kindStatus {
+		unlisted[p.URL] = true
+	}
+}
 
-func addProblem(url, errmsg string) {
-	msg := fmt.Sprintf("Error on %s: %s (from %s)", url, errmsg, linkSources[url])
+func addWarning(url, msg string) {
+	p := problem{URL: url, Err: msg, Sources: sources(url)}
 	if *verbose {
-		log.Print(msg)
+		log.Print(p.warning())
 	}
-	problems = append(problems, msg)
+	problemsMu.Lock()
+	warnings = append(warnings, p)
+	problemsMu.Unlock()
+}
+
+// interrupt stops the crawl early, as when linkcheck is sent a signal.
+func interrupt() {
+	problemsMu.Lock()
+	stopping = true
+	interrupted = true
+	problemsMu.Unlock()
+}
+
+// handleSignals stops the crawl on SIGINT or SIGTERM, so that the report
+// so far is still written, as when a containerized job is preempted. A
+// second signal kills linkcheck as usual.
+func handleSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		signal.Stop(c)
+		log.Printf("received %v, stopping crawl", sig)
+		interrupt()
+	}()
+}
+
+// stopped reports whether the crawl should stop early.
+func stopped() bool {
+	problemsMu.Lock()
+	defer problemsMu.Unlock()
+	return stopping
+}
+
+// A fetchResult describes a crawled URL.
+type fetchResult struct {
+	status      int      // HTTP status, 0 if there was no response
+	contentType string   // Content-Type of a 200 response
+	links       []string // links on the page, if it was crawled for them
+
+	duration time.Duration // time to the response headers
 }
 
-func crawlLoop() {
-	for url := range urlq {
-		if err := doCrawl(url); err != nil {
-			addProblem(url, err.Error())
+// A statusError is an unexpected HTTP response status.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e statusError) Error() string {
+	return e.status
+}
+
+// crawlLoop crawls the URLs from q until it's closed.
+func crawlLoop(q <-chan string) {
+	// With -independent-sessions each crawler keeps its own cookies, like a
+	// separate user, logging in itself with -login-url. Otherwise no
+	// cookies are kept, except the session from -login-url.
+	jar := sharedSession
+	if *independentSessions {
+		jar = newSession()
+	}
+	for url := range q {
+		crawlOne(url, jar)
+	}
+}
+
+// crawlFIFO crawls the queued URLs one at a time, in order, with
+// -single-threaded. With -strategy=dfs, the URLs each page queues are moved
+// to the front, in the order they're on the page.
+func crawlFIFO() {
+	jar := sharedSession
+	if *independentSessions {
+		jar = newSession()
+	}
+	for {
+		mu.Lock()
+		if len(fifo) == 0 {
+			mu.Unlock()
+			return
+		}
+		url := fifo[0]
+		fifo = fifo[1:]
+		queued := len(fifo)
+		mu.Unlock()
+		crawlOne(url, jar)
+		if *strategy == "dfs" {
+			mu.Lock()
+			found := append([]string(nil), fifo[queued:]...)
+			fifo = append(found, fifo[:queued]...)
+			mu.Unlock()
 		}
 	}
 }
 
-func doCrawl(url string) error {
-	defer wg.Done()
+var crawlSeq int64 // URLs taken from the queue, for -print-crawl-order
 
-	req, err := http.NewRequest("GET", url, nil)
+// crawlOne crawls url, taken from the queue, and records the result.
+func crawlOne(url string, jar http.CookieJar) {
+	if *printCrawlOrder {
+		log.Printf("crawl %d: %s", atomic.AddInt64(&crawlSeq, 1), url)
+	}
+	if *robotsDelay {
+		waitForHost(url)
+	}
+	release := admitHost(url)
+	fr, err := doCrawl(url, jar)
+	release()
 	if err != nil {
-		return err
+		crawlError(url, err)
+	} else if len(requiredRxs) > 0 || *recheckFile != "" {
+		noteReached(url)
+	}
+	if *format == "ndjson" {
+		writePageResult(url, fr, err)
+	}
+	if *format == "tap" || *format == "junit" || *reportDir != "" || *reportOK || *diffFile != "" || *sqlitePath != "" || *sitemapCoverage != "" {
+		noteResult(url, fr, err)
+	}
+	if *slowest > 0 && fr.duration > 0 {
+		noteTiming(url, fr.duration)
+	}
+	noteStatus(fr, err)
+	if *checkWWWParity && fr.status != 0 && isInternal(url) {
+		checkParity(url, fr.status)
+	}
+	atomic.AddInt64(&pending, -1)
+	if fetched != nil {
+		fetched(url, err)
+	}
+	wg.Done()
+	if *delay > 0 {
+		time.Sleep(jittered(*delay))
+	}
+}
+
+// jittered returns d randomly lengthened or shortened by up to
+// -delay-jitter percent.
+func jittered(d time.Duration) time.Duration {
+	if *delayJitter <= 0 {
+		return d
+	}
+	j := int64(d) * int64(*delayJitter) / 100
+	if j <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int63n(2*j+1)-j)
+}
+
+// redirectHop records a redirect from url to newURL, reporting whether
+// newURL is within -max-redirects of the link that started the chain.
+func redirectHop(url, newURL string) bool {
+	if i := strings.Index(newURL, "#"); i >= 0 {
+		newURL = newURL[:i]
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	n := redirects[url] + 1
+	if n > *maxRedirects {
+		return false
+	}
+	if _, ok := redirects[newURL]; !ok {
+		redirects[newURL] = n
+	}
+	// A redirect's target is at the same depth as the link to it.
+	if _, ok := depths[newURL]; !ok {
+		depths[newURL] = depths[url]
+		queryDepths[newURL] = queryDepths[url]
+	}
+	return true
+}
+
+// crawlError reports the error from crawling url.
+func crawlError(url string, err error) {
+	if _, onlyIDs := crawlMode(url); onlyIDs {
+		return
+	}
+	kind := kindFetch
+	if *retryLater != "" && transient(err) {
+		kind = kindTransient
+	}
+	if se, ok := err.(statusError); ok {
+		// The link isn't broken, we just aren't allowed to see it.
+		if *authAsWarning && (se.code == http.StatusUnauthorized || se.code == http.StatusForbidden) {
+			addWarning(url, se.status)
+			return
+		}
+		kind = kindStatus
+		if *suggestWayback && gone(se.code) && !isInternal(url) {
+			p := problem{Kind: kind, URL: url, Err: err.Error(), Sources: sources(url), Archive: waybackSnapshot(url)}
+			if *verbose {
+				log.Print(p)
+			}
+			recordProblem(p)
+			return
+		}
+	}
+	addProblem(kind, url, err.Error())
+}
+
+// authorize adds the -header headers and -bearer-token to req if it's for
+// the root's host. Credentials are only for our own site, never external
+// ones.
+func authorize(req *http.Request) {
+	if req.URL.Scheme != base.Scheme || req.URL.Host != base.Host {
+		return
+	}
+	for _, h := range headers {
+		if i := strings.Index(h, ":"); i > 0 {
+			req.Header.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+		}
+	}
+	if *bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+*bearerToken)
+	}
+	authorizeOAuth(req)
+}
+
+// expandSecrets expands ${VAR} references to environment variables in the
+// flags that may hold secrets, so they needn't appear on command lines.
+func expandSecrets() {
+	*bearerToken = os.ExpandEnv(*bearerToken)
+	*webhook = os.ExpandEnv(*webhook)
+	*oauthClientSecret = os.ExpandEnv(*oauthClientSecret)
+	for i, h := range headers {
+		headers[i] = os.ExpandEnv(h)
+	}
+}
+
+// roundTrip makes the request, retrying it once after a transient network
+// error: a connection reset, an unexpected EOF (as when a TLS handshake is
+// cut off), or a timeout. These say nothing about whether the link is
+// broken. With -retry or -retry-on-status, it also retries once after a
+// response with a transient status, waiting any short Retry-After first.
+func roundTrip(req *http.Request) (*http.Response, error) {
+	res, err := transportFor(req).RoundTrip(req)
+	// A timeout from the -url-deadline isn't worth retrying.
+	if err != nil && transient(err) && req.Context().Err() == nil {
+		if *verbose {
+			log.Printf("retrying %s after %v", req.URL, err)
+		}
+		if res, err = retry(req); err != nil {
+			return nil, err
+		}
+	}
+	if err == nil {
+		if wait, ok := retryWait(res); ok {
+			if *verbose {
+				log.Printf("retrying %s in %v after %s", req.URL, wait, res.Status)
+			}
+			res.Body.Close()
+			select {
+			case <-time.After(wait):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+			res, err = retry(req)
+		}
+	}
+	return res, err
+}
+
+// retry makes req again.
+func retry(req *http.Request) (*http.Response, error) {
+	if req.GetBody != nil {
+		// The first attempt consumed a ping's body.
+		var err error
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return transportFor(req).RoundTrip(req)
+}
+
+// redirectsHome reports whether a redirect from u to target is to the
+// root, or to the home page of u's host, from another page. A redirect
+// from the home page's index.html is just to its canonical URL.
+func redirectsHome(u, target *url.URL) bool {
+	if u.RawQuery == "" && path.Base(u.Path) == "index.html" && path.Dir(u.Path) == path.Clean(target.Path) {
+		return false
+	}
+	if target.String() == base.String() {
+		return u.Path != base.Path || u.RawQuery != ""
+	}
+	return target.Host == u.Host && target.Path == "/" && target.RawQuery == "" &&
+		(u.Path != "/" && u.Path != "" || u.RawQuery != "")
+}
+
+// deadlineError returns err, or a clearer error if it's because req's
+// -url-deadline passed.
+func deadlineError(req *http.Request, err error) error {
+	if errors.Is(req.Context().Err(), context.DeadlineExceeded) {
+		return deadlineExceeded{*urlDeadline}
+	}
+	return err
+}
+
+// deadlineExceeded is the error for a URL without a response within the
+// -url-deadline.
+type deadlineExceeded struct{ d time.Duration }
+
+func (e deadlineExceeded) Error() string {
+	return fmt.Sprintf("no response within -url-deadline %v", e.d)
+}
+
+func (deadlineExceeded) Timeout() bool { return true }
+
+func transient(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func doCrawl(url string, jar http.CookieJar) (fetchResult, error) {
+	var fr fetchResult
+	if stopped() {
+		return fr, nil
+	}
+	if trusted != nil {
+		if checkOnly, onlyIDs := crawlMode(url); isTrusted(url, checkOnly, onlyIDs) {
+			if *verbose {
+				log.Printf("trusting %s, OK last crawl", url)
+			}
+			return fr, nil
+		}
+	}
+
+	mu.Lock()
+	ping := pings[url]
+	mu.Unlock()
+	if !modifiedSinceTime.IsZero() && !ping && isInternal(url) {
+		// An unmodified page's links and ids are taken to have been
+		// checked already.
+		if checkOnly, onlyIDs := crawlMode(url); !checkOnly && !onlyIDs && unmodified(url, jar) {
+			return fr, nil
+		}
+	}
+	var req *http.Request
+	var err error
+	if ping {
+		req, err = http.NewRequest("POST", url, strings.NewReader("PING"))
+		if req != nil {
+			req.Header.Set("Content-Type", "text/ping")
+		}
+	} else {
+		req, err = http.NewRequest(requestMethod(url), url, nil)
 	}
-	res, err := http.DefaultTransport.RoundTrip(req)
 	if err != nil {
-		return err
+		return fr, err
+	}
+	if *urlDeadline > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), *urlDeadline)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	ranged := *acceptRangesCheck && req.Method == "GET" && isDownload(url)
+	if ranged {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	authorize(req)
+	if *acceptHeader != "" && req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", *acceptHeader)
+	}
+	if jar != nil {
+		for _, c := range jar.Cookies(req.URL) {
+			req.AddCookie(c)
+		}
+	}
+	linksChecked.Inc()
+	inFlight.Inc()
+	start := time.Now()
+	traceDone := func() {}
+	if *trace {
+		req, traceDone = traced(req)
+	}
+	res, err := roundTrip(req)
+	traceDone()
+	inFlight.Dec()
+	if err != nil {
+		return fr, deadlineError(req, err)
+	}
+	fr.duration = time.Since(start)
+	latency.Observe(fr.duration.Seconds())
+	fr.status = res.StatusCode
+	if jar != nil {
+		jar.SetCookies(req.URL, res.Cookies())
 	}
 
 	defer res.Body.Close()
 
 	// Handle redirects.
-	if res.StatusCode/100 == 3 {
+	if res.StatusCode/100 == 3 && *maxRedirects > 0 {
 		newURL, err := res.Location()
 		if err != nil {
-			return fmt.Errorf("resolving redirect: %v", err)
+			return fr, fmt.Errorf("resolving redirect: %v", err)
 		}
-		if !strings.HasPrefix(newURL.String(), *root) {
-			// Skip off-site redirects.
-			return nil
+		if req.URL.Scheme == "https" && newURL.Scheme == "http" && !*allowDowngrade {
+			msg := "insecure redirect from https to " + newURL.String()
+			if *downgradeError {
+				addProblem(kindRedirect, url, msg)
+			} else {
+				addWarning(url, msg)
+			}
+		}
+		normalizeHost(newURL)
+		noteRedirect(url, newURL.String())
+		if unexpectedRedirect(req.URL, newURL) {
+			addProblem(kindRedirect, url, "redirects to unexpected host "+newURL.Host)
+		}
+		if *homepageRedirect && redirectsHome(req.URL, newURL) {
+			addProblem(kindRedirect, url, "redirects to the home page "+newURL.String())
+			return fr, nil
+		}
+		if !isInternal(newURL.String()) {
+			// Off-site redirects aren't crawled, but where they end is
+			// reported.
+			if *reportChainLength || *reportRedirects || *fixDir != "" {
+				followOffsite(url, newURL.String())
+			}
+			return fr, nil
 		}
+		if !redirectHop(url, newURL.String()) {
+			addProblem(kindRedirect, url, fmt.Sprintf("too many redirects (more than %d)", *maxRedirects))
+			return fr, nil
+		}
+		noteLinkSource(newURL.String(), url)
 		crawl(newURL.String(), url)
-		return nil
+		return fr, nil
+	}
+	if ranged {
+		fr.contentType = res.Header.Get("Content-Type")
+		return fr, checkRange(url, res)
 	}
 	if res.StatusCode != 200 {
-		return errors.New(res.Status)
+		if _, onlyIDs := crawlMode(url); onlyIDs && *failOn5xx && res.StatusCode/100 == 5 {
+			// crawlError ignores the errors of pages only fetched for
+			// their ids, but not a server error.
+			addProblem(kindStatus, url, res.Status)
+		}
+		return fr, statusError{res.StatusCode, res.Status}
+	}
+	fr.contentType = res.Header.Get("Content-Type")
+	if *enforceMIME {
+		checkMIME(url, fr.contentType)
+	}
+	if *checkAssetCaching && isStaticAsset(fr.contentType) {
+		checkCaching(url, res.Header)
+	}
+	if *checkSRI && wantsDigest(url, fr.contentType) {
+		return fr, noteDigest(url, countingReader{res.Body})
 	}
-	// Don't recurse through external links -- just check them once
-	if strings.HasPrefix(url, *root) {
+	checkOnly, onlyIDs := crawlMode(url)
+	if *checkLastmod {
+		checkLastModified(url, res.Header)
+	}
+
+	if *checkImages || *checkSocialMeta && isSocialImage(url) {
+		ct := res.Header.Get("Content-Type")
+		if strings.HasPrefix(ct, "image/") {
+			checkImage(url, ct, countingReader{res.Body})
+			return fr, nil
+		}
+		if isSocialImage(url) {
+			addProblem(kindImage, url, "social meta image has content-type "+ct)
+			return fr, nil
+		}
+	}
+
+	if *checkManifest && isManifest(url) {
+		return fr, checkManifestIcons(url, countingReader{res.Body})
+	}
+
+	if *checkAssets && isInternal(url) && !checkOnly && !onlyIDs {
+		for _, ref := range linkHeaderRefs(res.Header["Link"]) {
+			if u, err := req.URL.Parse(ref); err == nil {
+				followLink(url, u.String(), true)
+			}
+		}
+	}
+
+	// Don't recurse through external links -- just check them once. Pages
+	// whose links we aren't following, and external pages whose fragments
+	// are checked, are still read for their ids.
+	internal := isInternal(url)
+	if !internal && fragmentsChecked(url) {
+		onlyIDs = true
+	}
+	if internal || onlyIDs {
+		if url == base.String() && !checkOnly && !onlyIDs {
+			noteRootLinks(0)
+		}
 
-		buf := bufio.NewReader(res.Body)
+		buf := bufio.NewReader(countingReader{res.Body})
 		// http.DetectContentType only uses first 512 bytes
 		peek, err := buf.Peek(512)
-		if err != nil {
-			log.Fatalf("Error initially reading %s body: %v", url, err)
+		if err != nil && err != io.EOF {
+			return fr, fmt.Errorf("reading body: %v", deadlineError(req, err))
 		}
 
-		if ct := http.DetectContentType(peek); !strings.HasPrefix(ct, "text/html") {
+		ct := http.DetectContentType(peek)
+		if ct == "application/pdf" && *checkPDFLinks && !checkOnly && !onlyIDs {
+			data, err := ioutil.ReadAll(buf)
+			if err != nil {
+				return fr, fmt.Errorf("reading PDF: %v", err)
+			}
+			links, err := pdfLinks(data)
+			if err != nil {
+				addWarning(url, err.Error())
+			}
+			for _, ref := range links {
+				if ref, ok := cleanHref(ref); ok {
+					if ref, ok := linkURL(url, ref); ok {
+						followLink(url, ref, true)
+					}
+				}
+			}
+			return fr, nil
+		}
+		if *checkJSONLinks && isJSON(fr.contentType) && !checkOnly && !onlyIDs {
+			data, err := ioutil.ReadAll(buf)
+			if err != nil {
+				return fr, fmt.Errorf("reading JSON: %v", err)
+			}
+			links, err := jsonLinks(data)
+			if err != nil {
+				addWarning(url, err.Error())
+			}
+			fr.links = links
+			for _, ref := range links {
+				if ref, ok := linkURL(url, ref); ok {
+					followLink(url, ref, false)
+				}
+			}
+			return fr, nil
+		}
+		if *checkFeeds && isFeed(fr.contentType) && !checkOnly && !onlyIDs {
+			data, err := ioutil.ReadAll(buf)
+			if err != nil {
+				return fr, fmt.Errorf("reading feed: %v", err)
+			}
+			links, enclosures, ok, err := feedLinks(data)
+			switch {
+			case ok:
+				fr.links = links
+				for _, ref := range links {
+					if ref, ok := linkURL(url, ref); ok {
+						followLink(url, ref, false)
+					}
+				}
+				for _, ref := range enclosures {
+					if ref, ok := linkURL(url, ref); ok {
+						followLink(url, ref, true)
+					}
+				}
+				return fr, nil
+			case err != nil && strings.Contains(fr.contentType, "+xml"):
+				addWarning(url, err.Error())
+				return fr, nil
+			}
+			// Other XML, such as XHTML, is read as usual.
+			buf = bufio.NewReader(bytes.NewReader(data))
+		}
+		if !strings.HasPrefix(ct, "text/html") && (len(htmlTypes) == 0 || !isHTMLType(fr.contentType)) {
 			if *verbose {
 				log.Printf("Skipping %s, content-type %s", url, ct)
 			}
-			return nil
+			return fr, nil
 		}
 
 		slurp, err := ioutil.ReadAll(buf)
 		if err != nil {
-			log.Fatalf("Error reading %s body: %v", url, err)
+			return fr, fmt.Errorf("reading body: %v", deadlineError(req, err))
 		}
 		if *verbose {
 			log.Printf("Len of %s: %d", url, len(slurp))
 		}
+		if *reparseEncoding {
+			slurp = toUTF8(url, slurp, fr.contentType)
+		}
 		body := string(slurp)
-		for _, ref := range getLinks(body) {
+		if renderRx != nil && renderRx.MatchString(url) {
 			if *verbose {
-				log.Printf("  links to %s", ref)
+				log.Printf("Rendering %s", url)
 			}
-			if excludeLink(ref) {
-				if *verbose {
-					log.Printf("    excluding %s", ref)
-				}
-				continue
+			body, err = renderPage(url)
+			if err != nil {
+				return fr, fmt.Errorf("rendering: %v", err)
+			}
+		}
+		pagesCrawled.Inc()
+		if bodyRx != nil && !checkOnly && !onlyIDs && !bodyRx.MatchString(body) {
+			addProblem(kindBody, url, "body validation failed: no match for "+bodyRx.String())
+		}
+		follow := !checkOnly && !onlyIDs
+		if follow && *respectRobotsMeta && headerNofollow(res.Header) {
+			if *verbose {
+				log.Printf("  not following links on %s: X-Robots-Tag nofollow", url)
+			}
+			follow = false
+		}
+		if follow && *dedupContent {
+			if orig := duplicateOf(url, body); orig != "" {
+				addWarning(url, "duplicate content of "+orig)
+				follow = false
+			}
+		}
+		var doc *html.Node
+		if follow || *checkFootnotes && internal {
+			doc = parsePage(url, body)
+		}
+		if follow && doc != nil {
+			atomic.AddInt64(&linkedPages, 1)
+			links, assets := getLinks(url, doc)
+			fr.links = links
+			if url == base.String() {
+				noteRootLinks(len(links) + len(assets))
 			}
-			dest := ref
-			linkSourcesMu.Lock()
-			linkSources[dest] = append(linkSources[dest], url)
-			linkSourcesMu.Unlock()
-			crawl(dest, url)
+			if *sampleRandom {
+				rand.Shuffle(len(links), func(i, j int) {
+					links[i], links[j] = links[j], links[i]
+				})
+			}
+			for _, ref := range links {
+				followLink(url, ref, false)
+			}
+			for _, ref := range assets {
+				followLink(url, ref, true)
+			}
+		}
+		if *checkFootnotes && internal && doc != nil {
+			checkPageFootnotes(url, doc)
 		}
 		for _, id := range pageIDs(body) {
 			if *verbose {
 				log.Printf(" url %s has #%s", url, id)
 			}
-			fragExistsMu.Lock()
-			fragExists[urlFrag{url, id}] = true
-			fragExistsMu.Unlock()
+			noteFragExists(urlFrag{url, id})
 		}
 	}
-	return nil
+	return fr, nil
 }
 
 func main() {
 	flag.Parse()
 
+	if *serveDir != "" {
+		*root = serveDirectory(*serveDir)
+		if *verbose {
+			log.Printf("serving %s on %s", *serveDir, *root)
+		}
+	}
 	var err error
 	base, err = url.Parse(*root)
 	if err != nil {
 		log.Fatalf("parsing root URL: %v", err)
 	}
+	normalizeHost(base)
 	if base.Path == "" {
 		base.Path = "/"
 	}
 
+	for i, prefix := range excludePaths {
+		u, err := parseUrl(prefix)
+		if err != nil {
+			log.Fatalf("parsing -exclude %q: %v", prefix, err)
+		}
+		excludePaths[i] = u
+	}
+	if err := loadIgnoreFile(*ignoreFile); err != nil {
+		log.Fatalf("reading -ignore-file: %v", err)
+	}
+	expandSecrets()
+	setupOAuth()
+	for _, h := range headers {
+		if !strings.Contains(h, ":") {
+			log.Fatalf(`-header %q must be "Name: value"`, h)
+		}
+	}
+
+	if *clientCert != "" || *clientKey != "" {
+		if err := loadClientCert(); err != nil {
+			log.Fatalf("loading client certificate: %v", err)
+		}
+	}
+	if *dnsWarmup {
+		otherTransport = warmedTransport()
+	}
+	if *sshJump != "" {
+		if *dnsWarmup || *useHTTP3 {
+			log.Fatalf("-ssh-jump can't be used with -dns-warmup or -http3")
+		}
+		client, err := dialSSHJump()
+		if err != nil {
+			log.Fatalf("connecting to -ssh-jump host: %v", err)
+		}
+		siteTransport = throughSSH(siteTransport, client)
+		otherTransport = throughSSH(otherTransport, client)
+	}
+	if *useHTTP3 {
+		if !http3Supported {
+			log.Fatalf("-http3 requires linkcheck to be built with -tags http3")
+		}
+		siteTransport = withHTTP3(siteTransport)
+		otherTransport = withHTTP3(otherTransport)
+	}
+
+	if err := parseModifiedSince(); err != nil {
+		log.Fatal(err)
+	}
+	if err := compileRequired(); err != nil {
+		log.Fatal(err)
+	}
+	if err := parseRetryStatuses(); err != nil {
+		log.Fatal(err)
+	}
+	if err := compileMethods(); err != nil {
+		log.Fatal(err)
+	}
+	if jsonSteps, err = compileJSONPath(*jsonPath); err != nil {
+		log.Fatal(err)
+	}
+
+	if *excludeSelector != "" {
+		excludeSel, err = cascadia.Compile(*excludeSelector)
+		if err != nil {
+			log.Fatalf("parsing -exclude-selector: %v", err)
+		}
+	}
+
+	if *render != "" {
+		if !renderSupported {
+			log.Fatalf("-render requires linkcheck to be built with -tags render")
+		}
+		renderRx, err = regexp.Compile(*render)
+		if err != nil {
+			log.Fatalf("parsing -render: %v", err)
+		}
+	}
+
+	switch *trailingSlash {
+	case "", "yes", "no":
+	default:
+		log.Fatalf(`-enforce-trailing-slash must be "yes" or "no"`)
+	}
+	switch *groupBy {
+	case "", "source", "target":
+	default:
+		log.Fatalf(`-group-by must be "source" or "target"`)
+	}
+	switch *format {
+	case "text", "json", "ndjson", "tap", "junit", "html":
+	default:
+		log.Fatalf(`-format must be "text", "json", "ndjson", "tap", "junit", or "html"`)
+	}
+
+	if *requireBody != "" {
+		bodyRx, err = regexp.Compile(*requireBody)
+		if err != nil {
+			log.Fatalf("parsing -require-body-match: %v", err)
+		}
+	}
+
+	tmpl, err := reportTemplate(*reportTmpl)
+	if err != nil {
+		log.Fatalf("loading report template: %v", err)
+	}
+
+	if *updateBaseline && *baselineFile == "" {
+		log.Fatalf("-update-baseline requires -baseline")
+	}
+	if *baselineFile != "" && !*updateBaseline {
+		if err := loadBaseline(*baselineFile); err != nil {
+			log.Fatalf("loading baseline: %v", err)
+		}
+	}
+	if *diffFile != "" {
+		// The exit status is for the links newly broken, not every broken
+		// one that -max-failure-rate counts.
+		if maxFailureRate >= 0 {
+			log.Fatalf("-max-failure-rate can't be used with -diff")
+		}
+		if err := loadDiff(*diffFile); err != nil {
+			log.Fatalf("loading previous crawl: %v", err)
+		}
+	}
+	if *recheckFile != "" {
+		if err := loadTrusted(*recheckFile); err != nil {
+			log.Fatalf("loading -recheck-failures-only: %v", err)
+		}
+	}
+
 	if *crawlers < 1 {
 		log.Fatalf("need at least one crawler")
 	}
+	if *checkpointInterval > 0 && *reportDir == "" {
+		log.Fatalf("-checkpoint-interval requires -report-dir")
+	}
+	if *externalCrawlers < 0 {
+		log.Fatalf("-external-crawlers can't be negative")
+	}
+	if *strategy != "bfs" && *strategy != "dfs" {
+		log.Fatalf(`-strategy must be "bfs" or "dfs"`)
+	}
+	if *strategy == "dfs" && !*singleThreaded {
+		log.Fatalf("-strategy=dfs requires -single-threaded, since concurrent crawlers take URLs as they come")
+	}
+
+	if *tuiMode && !tuiSupported {
+		log.Fatalf("-tui requires linkcheck to be built with -tags tui")
+	}
+	if *sqlitePath != "" && !sqliteSupported {
+		log.Fatalf("-sqlite requires linkcheck to be built with -tags sqlite")
+	}
+	if *streamErrors {
+		switch {
+		case *format != "text" && *format != "ndjson":
+			log.Fatalf(`-stream-errors requires -format "text" or "ndjson"`)
+		case *groupBy != "" || *reportTmpl != "" || *reportDir != "" || *updateBaseline || *diffFile != "" ||
+			*sqlitePath != "" || *tuiMode || *serveAddr != "":
+			log.Fatalf("-stream-errors can't be used with -group-by, -report-template, -report-dir, -update-baseline, -diff, -sqlite, -tui, or -serve, which need every error at the end of the crawl")
+		}
+	}
+
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr)
+	}
+	if *pprofAddr != "" {
+		go servePprof(*pprofAddr)
+	}
+	if *memProfileDir != "" {
+		if *memProfileInterval <= 0 {
+			log.Fatalf("-mem-profile-interval must be positive")
+		}
+		if err := os.MkdirAll(*memProfileDir, 0755); err != nil {
+			log.Fatalf("creating -mem-profile-dir: %v", err)
+		}
+		go writeHeapProfiles(*memProfileDir, *memProfileInterval)
+	}
+
+	if *serveAddr != "" {
+		serve()
+		return
+	}
+
+	start := time.Now()
+	var data reportData
+	if *tuiMode {
+		data = runTUI()
+	} else {
+		handleSignals()
+		data = run()
+	}
+	if *webhook != "" {
+		postWebhook(data)
+	}
+	if *sqlitePath != "" {
+		if err := writeSQLite(*sqlitePath, data, start, time.Now()); err != nil {
+			log.Fatalf("writing to SQLite database: %v", err)
+		}
+	}
+	if *recheckFile != "" {
+		if err := writeTrusted(*recheckFile); err != nil {
+			log.Fatalf("writing -recheck-failures-only: %v", err)
+		}
+	}
+	if *retryLater != "" {
+		if err := writeRetryLater(*retryLater, data); err != nil {
+			log.Fatalf("writing -retry-later: %v", err)
+		}
+	}
+	if *dumpIndex != "" {
+		if err := writeIndex(*dumpIndex); err != nil {
+			log.Fatalf("writing -dump-index: %v", err)
+		}
+	}
+	if seenDisk != nil {
+		// Nothing after this looks up the URLs crawled.
+		seenDisk.close()
+		seenDisk = nil
+	}
+	if *updateBaseline {
+		if data.Suppressed > 0 || data.Stopped {
+			log.Printf("warning: baseline is incomplete because of -max-errors")
+		}
+		if err := writeBaseline(*baselineFile, data.Problems); err != nil {
+			log.Fatalf("writing baseline: %v", err)
+		}
+		return
+	}
+	if *reportDir != "" {
+		if err := writeReportDir(*reportDir, data); err != nil {
+			log.Fatalf("writing reports: %v", err)
+		}
+	}
+	if err := writeReport(os.Stdout, data, tmpl); err != nil {
+		log.Fatalf("writing report: %v", err)
+	}
+	if *fixDir != "" {
+		if err := fixLinks(*fixDir, data, os.Stdout); err != nil {
+			log.Fatalf("fixing links: %v", err)
+		}
+	}
+	if n := atomic.LoadInt64(&linkedPages); *minPages > 0 && n < int64(*minPages) {
+		log.Printf("only %d pages crawled for their links, fewer than -min-pages %d", n, *minPages)
+		os.Exit(3)
+	}
+	if data.Diff != nil {
+		if len(data.Diff.Broken) > 0 {
+			os.Exit(1)
+		}
+	} else if maxFailureRate >= 0 {
+		if rate, over := overFailureRate(data); over {
+			log.Printf("%.1f%% of URLs checked are broken, more than -max-failure-rate %v", rate, &maxFailureRate)
+			os.Exit(1)
+		}
+	} else if len(data.Problems) > 0 || data.Streamed > 0 {
+		os.Exit(1)
+	}
+}
+
+// fragmentsChecked reports whether links to fragments of rawurl are
+// checked: those on the root's host, in local files, and on the
+// -allow-fragment-hosts, unless the host is in -ignore-fragments-on-hosts,
+// which takes precedence.
+func fragmentsChecked(rawurl string) bool {
+	if hostMatches(rawurl, ignoreFragHosts) {
+		return false
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "file" || u.Host == base.Host {
+		return true
+	}
+	return hostMatches(rawurl, allowFragHosts)
+}
+
+// checkFragments reports the missing fragments once the crawl is done.
+func checkFragments() {
+	var ids map[string][]string // with -fuzzy-fragment-suggestions, once a fragment is missing
+	for uf, needers := range neededFrags {
+		if !fragmentsChecked(uf.url) || unmodifiedPages[uf.url] {
+			continue
+		}
+		if !fragExists[uf] {
+			p := problem{Kind: kindFragment, URL: uf.url, Frag: uf.frag, Err: "missing fragment", Sources: needers}
+			if *fuzzyFragments || *fixDir != "" {
+				if ids == nil {
+					ids = idsByPage()
+				}
+				p.Suggestion = closestID(uf.frag, ids[uf.url])
+			}
+			recordProblem(p)
+		}
+	}
+}
+
+// checkUnusedIDs warns about the ids on each internal page or local file
+// that no fragment link targets, once the crawl is done.
+func checkUnusedIDs() {
+	unused := make(map[string][]string) // page -> unused ids
+	for uf := range fragExists {
+		if !isInternal(uf.url) && !strings.HasPrefix(uf.url, "file:") {
+			continue
+		}
+		if _, ok := neededFrags[uf]; !ok {
+			unused[uf.url] = append(unused[uf.url], "#"+uf.frag)
+		}
+	}
+	pages := make([]string, 0, len(unused))
+	for page := range unused {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	for _, page := range pages {
+		ids := unused[page]
+		sort.Strings(ids)
+		addWarning(page, fmt.Sprintf("%d ids never linked to: %s", len(ids), strings.Join(ids, ", ")))
+	}
+}
+
+// reset clears the state left by a previous crawl.
+func reset() {
+	mu.Lock()
+	crawled = make(map[string]bool)
+	if seenDisk != nil {
+		seenDisk.close()
+		seenDisk = nil
+	}
+	reached = make(map[string]bool)
+	unmodifiedPages = make(map[string]bool)
+	noRecurse = make(map[string]bool)
+	idsOnly = make(map[string]bool)
+	neededFrags = make(map[urlFrag][]string)
+	templates = make(map[string]int)
+	hostCounts = make(map[string]int)
+	redirects = make(map[string]int)
+	redirectTargets = make(map[string]string)
+	redirectStarts = make(map[string]bool)
+	depths = make(map[string]int)
+	rootLinks = -1
+	queryDepths = make(map[string]int)
+	pings = make(map[string]bool)
+	dropped = make(map[string]bool)
+	fifo = nil
+	canonicals = make(map[string]string)
+	hreflangs = make(map[string]map[string]string)
+	integrities = make(map[string]map[string][]string)
+	digests = make(map[string]map[string]string)
+	ampPages = make(map[string]ampLinks)
+	socialImages = make(map[string]bool)
+	manifests = make(map[string]bool)
+	anchorTargets = make(map[string]map[string]bool)
+	sitemapLastmods = make(map[string]time.Time)
+	insecureLinks = make(map[string]bool)
+	contentHashes = make(map[[sha256.Size]byte]string)
+	mu.Unlock()
+
+	linkSourcesMu.Lock()
+	linkSources = make(map[string][]string)
+	linkSourcesMu.Unlock()
+	fragExistsMu.Lock()
+	fragExists = make(map[urlFrag]bool)
+	fragExistsMu.Unlock()
+	mdIDsMu.Lock()
+	mdIDs = make(map[string]bool)
+	mdIDsMu.Unlock()
+
+	robotsMu.Lock()
+	robots = make(map[string]*hostRobots)
+	robotsMu.Unlock()
+
+	problemsMu.Lock()
+	problems = nil
+	warnings = nil
+	suppressed = 0
+	streamed = 0
+	unlisted = make(map[string]bool)
+	stopping = false
+	interrupted = false
+	results = nil
+	timings = nil
+	statuses = make(map[string]int)
+	problemsMu.Unlock()
+
+	atomic.StoreInt64(&bytesRead, 0)
+	atomic.StoreInt64(&pending, 0)
+	atomic.StoreInt64(&crawlSeq, 0)
+	atomic.StoreInt64(&linkedPages, 0)
+	urlq = make(chan string)
+	extq = make(chan string)
+}
+
+// run crawls the site from the root and returns the results.
+func run() reportData {
+	reset()
 
 	if *verbose {
 		log.Printf("starting %d crawlers", *crawlers)
 	}
 
-	for i := 0; i < *crawlers; i++ {
-		go crawlLoop()
+	if *diskQueueDir != "" {
+		var err error
+		if seenDisk, err = newDiskSet(*diskQueueDir); err != nil {
+			log.Fatalf("creating -disk-queue: %v", err)
+		}
+	}
+
+	sharedSession = nil
+	if *loginURL != "" && !*independentSessions {
+		sharedSession = newSession()
+	}
+	if !*singleThreaded {
+		for i := 0; i < *crawlers; i++ {
+			go crawlLoop(urlq)
+		}
+		for i := 0; i < *externalCrawlers; i++ {
+			go crawlLoop(extq)
+		}
+		if *diskQueueDir != "" {
+			startDiskQueues()
+		}
 	}
 
-	crawl(base.String(), "")
+	stopCheckpoints := startCheckpoints()
+	stopHeartbeat := startHeartbeat()
+
+	switch {
+	case *changedSince != "":
+		checkChanged()
+	case *markdownPath != "":
+		checkMarkdown(*markdownPath)
+	case *accessLog != "":
+		checkAccessLog(*accessLog)
+	case *stdinMode:
+		checkStdin()
+	case *harFile != "":
+		checkHAR(*harFile)
+	case *sitemapURL != "":
+		u, err := parseUrl(*sitemapURL)
+		if err != nil {
+			log.Fatalf("parsing -sitemap: %v", err)
+		}
+		checkSitemap(u)
+	default:
+		crawl(base.String(), "")
+	}
+	if *singleThreaded {
+		crawlFIFO()
+	}
 
 	wg.Wait()
+	if *sitemapCoverage != "" {
+		crawlSitemapCoverage()
+		if *singleThreaded {
+			crawlFIFO()
+		}
+		wg.Wait()
+	}
+	stopCheckpoints()
+	stopHeartbeat()
+	if urlDiskq != nil {
+		urlDiskq.close()
+		extDiskq.close()
+		urlDiskq, extDiskq = nil, nil
+	}
 	close(urlq)
-	for uf, needers := range neededFrags {
-		if !fragExists[uf] {
-			problems = append(problems, fmt.Sprintf("Missing fragment for %+v from %v", uf, needers))
+	close(extq)
+	checkInsecure()
+	checkDropped()
+	checkRedirectLoops()
+	if rootLinks == 0 {
+		// A 200 root without links is probably rendered by JavaScript,
+		// or wasn't HTML, and the crawl checked almost nothing.
+		msg := "root page has no links"
+		if *failEmptyRoot {
+			addProblem(kindEmpty, base.String(), msg)
+		} else {
+			addWarning(base.String(), msg)
+		}
+	}
+	// An interrupted crawl hasn't seen every page, so its results can't be
+	// reliably checked.
+	if !stopping {
+		checkFragments()
+		if *reportUnusedIDs {
+			checkUnusedIDs()
+		}
+		checkCanonicals()
+		checkAMPLinks()
+		if *checkHreflang {
+			checkHreflangs()
+		}
+		if *checkSRI {
+			checkIntegrities()
+		}
+		checkReached()
+		if *reportDeepPages >= 0 {
+			checkDeepPages()
 		}
 	}
 
-	for _, s := range problems {
-		fmt.Println(s)
+	sortProblems(problems)
+	sortProblems(warnings)
+	data := reportData{
+		Problems:    problems,
+		Warnings:    warnings,
+		Suppressed:  suppressed,
+		Streamed:    streamed,
+		Unlisted:    unlisted,
+		Stopped:     stopping,
+		Interrupted: interrupted,
+		Checked:     crawledCount(),
+		Bytes:       atomic.LoadInt64(&bytesRead),
+		Results:     results,
+		Statuses:    statuses,
 	}
-	if len(problems) > 0 {
-		os.Exit(1)
+	applyBaseline(&data)
+	if *reportOK || *diffFile != "" {
+		for _, r := range results {
+			if r.Error == "" {
+				data.Pages = append(data.Pages, r.URL)
+			}
+		}
+		sort.Strings(data.Pages)
+	}
+	if *reportOK {
+		data.OK = okURLs(data)
+	}
+	if previous != nil {
+		data.Diff = diffCrawls(*previous, data)
+	}
+	if *slowest > 0 {
+		data.Slowest = slowestURLs(*slowest)
+	}
+	if *listExternalHosts {
+		data.ExternalHosts = externalHosts()
+	}
+	if *reportInconsistentAnchors {
+		data.InconsistentAnchors = inconsistentAnchors()
+	}
+	if *reportExternalHTTP {
+		data.ExternalHTTP = insecureExternalHosts()
+	}
+	if *sitemapCoverage != "" {
+		data.Coverage = coverage(data)
+	}
+	if *reportChainLength {
+		data.RedirectChains = redirectChains()
+	}
+	if *reportRedirects {
+		data.Redirects = redirectedLinks()
 	}
+	return data
 }
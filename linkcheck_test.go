@@ -0,0 +1,316 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// crawlTest crawls the site at rootURL as main would, with flags set to
+// the given values for the crawl, and returns the results.
+func crawlTest(t *testing.T, rootURL string, flags map[string]string) reportData {
+	t.Helper()
+	defer func(old string) { *root = old }(*root)
+	*root = rootURL
+	for name, value := range flags {
+		f := flag.Lookup(name)
+		if f == nil {
+			t.Fatalf("no flag -%s", name)
+		}
+		old := f.Value.String()
+		if err := f.Value.Set(value); err != nil {
+			t.Fatalf("setting -%s: %v", name, err)
+		}
+		defer f.Value.Set(old)
+	}
+
+	var err error
+	if base, err = url.Parse(rootURL); err != nil {
+		t.Fatal(err)
+	}
+	normalizeHost(base)
+	if base.Path == "" {
+		base.Path = "/"
+	}
+	return run()
+}
+
+// fixtureLinks returns the links getLinks finds on the page in the
+// testdata file, taken to be the root at pageURL.
+func fixtureLinks(t *testing.T, file, pageURL string) []string {
+	t.Helper()
+	body, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base, err = url.Parse(pageURL); err != nil {
+		t.Fatal(err)
+	}
+	normalizeHost(base)
+	reset()
+	links, _ := getLinks(base.String(), parsePage(base.String(), string(body)))
+	return links
+}
+
+// problemURLs returns the URLs, with any fragment, of ps.
+func problemURLs(ps []problem) []string {
+	var urls []string
+	for _, p := range ps {
+		u := p.URL
+		if p.Frag != "" {
+			u += "#" + p.Frag
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// generatedSite serves n pages, at generatedPage(0) to generatedPage(n-1).
+// Each links to the next few pages and to an id on another, and every
+// tenth links to a missing page, so a crawl updates most of the shared
+// state from many crawlers at once.
+func generatedSite(n int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := 0
+		if r.URL.Path != "/" {
+			var err error
+			i, err = strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+			if err != nil || i <= 0 || i >= n {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<!doctype html><title>%d</title><h1 id=\"top\">%d</h1>\n", i, i)
+		for j := 1; j <= 5; j++ {
+			fmt.Fprintf(w, "<a href=\"%s\">next</a>\n", generatedPage((i+j)%n))
+		}
+		fmt.Fprintf(w, "<a href=\"%s#top\">top</a>\n", generatedPage((i*7)%n))
+		if i%10 == 0 {
+			fmt.Fprintf(w, "<a href=\"/missing/%d\">gone</a>\n", i)
+		}
+	})
+}
+
+// generatedPage returns the path of the generatedSite page i. Page 0 is
+// the root.
+func generatedPage(i int) string {
+	if i == 0 {
+		return "/"
+	}
+	return "/" + strconv.Itoa(i)
+}
+
+// TestConcurrentCrawl crawls a large site with many crawlers, so that
+// go test -race catches unguarded access to the shared crawl state.
+func TestConcurrentCrawl(t *testing.T) {
+	const pages = 1000
+	ts := httptest.NewServer(generatedSite(pages))
+	defer ts.Close()
+
+	data := crawlTest(t, ts.URL, map[string]string{"crawlers": "50"})
+	if want := pages + pages/10; data.Checked != want {
+		t.Errorf("checked %d URLs, want %d", data.Checked, want)
+	}
+	if len(data.Problems) != pages/10 {
+		t.Fatalf("%d problems, want %d: %v", len(data.Problems), pages/10, problemURLs(data.Problems))
+	}
+	for _, p := range data.Problems {
+		if !strings.HasPrefix(p.URL, ts.URL+"/missing/") || p.Kind != kindStatus {
+			t.Errorf("unexpected %s problem on %s: %s", p.Kind, p.URL, p.Err)
+		}
+	}
+}
+
+// TestHosts checks that links to IPv6 and internationalized hosts are
+// normalized, so that they're deduplicated and classified as internal or
+// external like any other.
+func TestHosts(t *testing.T) {
+	tests := []struct {
+		file, root string
+		links      []string
+		internal   []bool
+	}{
+		{
+			"ipv6.html", "http://[::1]:8000/",
+			[]string{"http://[::1]:8000/a", "http://[::1]:8000/b", "http://[::1]:8001/c"},
+			[]bool{true, true, false},
+		},
+		{
+			"idn.html", "http://例え.jp/",
+			[]string{"http://xn--r8jz45g.jp/a", "http://xn--r8jz45g.jp/b", "http://xn--r8jz45g.jp/c", "http://xn--r8jz45g.com/d"},
+			[]bool{true, true, true, false},
+		},
+	}
+	for _, tt := range tests {
+		links := fixtureLinks(t, tt.file, tt.root)
+		if !reflect.DeepEqual(links, tt.links) {
+			t.Errorf("%s: links %q, want %q", tt.file, links, tt.links)
+			continue
+		}
+		for i, link := range links {
+			if got := isInternal(link); got != tt.internal[i] {
+				t.Errorf("%s: isInternal(%q) = %v, want %v", tt.file, link, got, tt.internal[i])
+			}
+		}
+	}
+}
+
+// TestRetryTransient checks that a page whose first request fails with a
+// connection closed before any response is retried and reported as OK.
+func TestRetryTransient(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" && atomic.AddInt32(&requests, 1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!doctype html><title>ok</title><a href="/a">a</a>`)
+	}))
+	defer ts.Close()
+
+	data := crawlTest(t, ts.URL, nil)
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("root requested %d times, want 2", got)
+	}
+	if len(data.Problems) != 0 {
+		t.Errorf("problems %v, want none", problemURLs(data.Problems))
+	}
+	if data.Checked != 2 {
+		t.Errorf("checked %d URLs, want 2", data.Checked)
+	}
+}
+
+// TestNormalizeUnicode checks that with -normalize-unicode, a link whose
+// path and fragment are in NFD finds the page and id in NFC, and that
+// without it the link is broken.
+func TestNormalizeUnicode(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata/nfc")))
+	defer ts.Close()
+
+	data := crawlTest(t, ts.URL, map[string]string{"normalize-unicode": "true"})
+	if len(data.Problems) != 0 {
+		t.Errorf("with -normalize-unicode: problems %v, want none", problemURLs(data.Problems))
+	}
+	data = crawlTest(t, ts.URL, nil)
+	if len(data.Problems) == 0 {
+		t.Errorf("without -normalize-unicode: no problems, want the NFD link broken")
+	}
+}
+
+// TestReparseOnEncoding checks that with -reparse-on-encoding, the links
+// and ids of a Shift-JIS page, declared by a <meta charset>, are found.
+func TestReparseOnEncoding(t *testing.T) {
+	files := http.FileServer(http.Dir("testdata/shiftjis"))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Leave the encoding to the page, not the file server's UTF-8.
+		w.Header().Set("Content-Type", "text/html")
+		files.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	data := crawlTest(t, ts.URL, map[string]string{"reparse-on-encoding": "true"})
+	if len(data.Problems) != 0 || data.Checked != 2 {
+		t.Errorf("with -reparse-on-encoding: checked %d URLs with problems %v, want 2 without", data.Checked, problemURLs(data.Problems))
+	}
+	data = crawlTest(t, ts.URL, nil)
+	if len(data.Problems) == 0 {
+		t.Errorf("without -reparse-on-encoding: no problems, want the Shift-JIS link broken")
+	}
+}
+
+// TestExclusion checks which rule exclusion gives for URLs that more than
+// one rule excludes.
+func TestExclusion(t *testing.T) {
+	var err error
+	if base, err = url.Parse("http://example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(hosts, paths listFlag, rules []ignoreRule, respect bool) {
+		excludeHosts, excludePaths, ignoreRules, *respectRobotsTxt = hosts, paths, rules, respect
+	}(excludeHosts, excludePaths, ignoreRules, *respectRobotsTxt)
+	excludeHosts = listFlag{"cdn.example.com"}
+	excludePaths = listFlag{"http://example.com/drafts/secret/", "http://example.com/docs/old/keep"}
+	ignoreRules = nil
+	if err := loadIgnoreFile("testdata/exclude.linkcheckignore"); err != nil {
+		t.Fatal(err)
+	}
+	*respectRobotsTxt = true
+	reset()
+	r := &hostRobots{robotsGroup: parseRobots(strings.NewReader("User-agent: *\nDisallow: /private/\nDisallow: /drafts/\n"))}
+	r.once.Do(func() {})
+	robots["http://example.com"] = r
+
+	tests := []struct {
+		ref, why string
+	}{
+		{"http://example.com/", ""},
+		{"mailto:drafts@cdn.example.com", "scheme mailto:"},
+		{"javascript:void(0)", "scheme javascript:"},
+		{"http://cdn.example.com/drafts/x.html", "-exclude-host cdn.example.com"},
+		{"http://img.cdn.example.com/a.png", "-exclude-host cdn.example.com"},
+		{"http://example.com/drafts/secret/x.html", "-exclude http://example.com/drafts/secret/"},
+		{"http://example.com/drafts/x.html", `-ignore-file pattern "/drafts/"`},
+		{"http://example.com/docs/old/a.html", `-ignore-file pattern "/docs/old/"`},
+		// The ignore file's "!" re-includes what it ignores, but not what
+		// -exclude does.
+		{"http://example.com/docs/old/keep.html", "-exclude http://example.com/docs/old/keep"},
+		{"http://example.com/private/ignored.html", `-ignore-file pattern "/private/ignored.html"`},
+		{"http://example.com/private/x.html", "robots.txt"},
+	}
+	for _, tt := range tests {
+		if why := exclusion(tt.ref); why != tt.why {
+			t.Errorf("exclusion(%q) = %q, want %q", tt.ref, why, tt.why)
+		}
+	}
+
+	// Without -exclude, the "!" pattern re-includes the page.
+	excludePaths = nil
+	if why := exclusion("http://example.com/docs/old/keep.html"); why != "" {
+		t.Errorf("without -exclude: exclusion of the re-included page = %q, want none", why)
+	}
+}
+
+// TestLinkedPages checks that only the pages on the site whose links are
+// read count toward -min-pages, not the external links and assets that
+// are checked but not crawled.
+func TestLinkedPages(t *testing.T) {
+	ext := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!doctype html><title>external</title>`)
+	}))
+	defer ext.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/style.css" {
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, "body {}")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!doctype html><title>page</title><link rel="stylesheet" href="/style.css"><a href="/a">a</a><a href="`+ext.URL+`/">external</a>`)
+	}))
+	defer ts.Close()
+
+	data := crawlTest(t, ts.URL, nil)
+	if len(data.Problems) != 0 {
+		t.Fatalf("problems %v, want none", problemURLs(data.Problems))
+	}
+	if got := atomic.LoadInt64(&linkedPages); got != 2 {
+		t.Errorf("%d pages crawled for their links, want 2 of %d URLs checked", got, data.Checked)
+	}
+}
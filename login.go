@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strings"
+)
+
+var (
+	loginURL  = flag.String("login-url", "", "before crawling, POST -login-data to this login form URL and crawl with the session cookies it sets")
+	loginData = flag.String("login-data", "", `form fields to POST to -login-url, e.g. "user=me&password=$PASSWORD" (environment variables are expanded)`)
+)
+
+// sharedSession is the cookie jar logged in with -login-url, shared by the
+// crawlers unless they have -independent-sessions. It's set in run.
+var sharedSession http.CookieJar
+
+// siteTransports makes a request with transportFor, for an http.Client.
+type siteTransports struct{}
+
+func (siteTransports) RoundTrip(req *http.Request) (*http.Response, error) {
+	return roundTrip(req)
+}
+
+// newSession returns a new cookie jar, logged in with -login-url if it's
+// set.
+func newSession() http.CookieJar {
+	jar, _ := cookiejar.New(nil)
+	if *loginURL == "" {
+		return jar
+	}
+	if err := login(jar); err != nil {
+		log.Fatalf("logging in: %v", err)
+	}
+	return jar
+}
+
+// login posts the -login-data to the -login-url, following any redirect
+// and keeping the cookies set in jar.
+func login(jar http.CookieJar) error {
+	u, err := parseUrl(*loginURL)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", u, strings.NewReader(os.ExpandEnv(*loginData)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	authorize(req)
+	client := &http.Client{Transport: siteTransports{}, Jar: jar}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("%s: %s", u, res.Status)
+	}
+	if len(jar.Cookies(base)) == 0 {
+		return fmt.Errorf("%s set no cookies for %s", u, base)
+	}
+	if *verbose {
+		log.Printf("logged in at %s", u)
+	}
+	return nil
+}
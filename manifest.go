@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+
+	"golang.org/x/net/html"
+)
+
+var checkManifest = flag.Bool("check-manifest", false, "also check favicons and other <link> icons, web app manifests, and the icons the manifests list")
+
+// iconRels are the <link> rels of icons checked by -check-manifest.
+var iconRels = []string{"icon", "apple-touch-icon", "apple-touch-icon-precomposed", "mask-icon"}
+
+// manifests are the URLs of web app manifests, whose icons are checked. It's
+// guarded by mu.
+var manifests = make(map[string]bool)
+
+// iconOrManifest returns the URL of n if it's a <link> to an icon or a
+// manifest, and whether it's a manifest.
+func iconOrManifest(n *html.Node) (ref string, isManifest, ok bool) {
+	if isLinkRel(n, "manifest") {
+		isManifest = true
+	} else {
+		for _, rel := range iconRels {
+			if isLinkRel(n, rel) {
+				ok = true
+			}
+		}
+		if !ok {
+			return "", false, false
+		}
+	}
+	ref, valid := cleanHref(attr(n, "href"))
+	if !valid || ref == "" {
+		return "", false, false
+	}
+	return ref, isManifest, true
+}
+
+func noteManifest(url string) {
+	mu.Lock()
+	manifests[url] = true
+	mu.Unlock()
+}
+
+func isManifest(url string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return manifests[url]
+}
+
+// webManifest is the part of a web app manifest listing images.
+type webManifest struct {
+	Icons       []manifestImage `json:"icons"`
+	Screenshots []manifestImage `json:"screenshots"`
+	Shortcuts   []struct {
+		Icons []manifestImage `json:"icons"`
+	} `json:"shortcuts"`
+}
+
+type manifestImage struct {
+	Src string `json:"src"`
+}
+
+// checkManifestIcons checks the icons, screenshots, and shortcut icons in
+// the manifest at manifestURL read from r. Their URLs are relative to the
+// manifest.
+func checkManifestIcons(manifestURL string, r io.Reader) error {
+	var m webManifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return fmt.Errorf("parsing manifest: %v", err)
+	}
+	images := append(m.Icons, m.Screenshots...)
+	for _, s := range m.Shortcuts {
+		images = append(images, s.Icons...)
+	}
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		ref, ok := cleanHref(img.Src)
+		if !ok || ref == "" {
+			continue
+		}
+		if u, err := base.Parse(ref); err == nil {
+			normalizeHost(u)
+			followLink(manifestURL, u.String(), true)
+		}
+	}
+	return nil
+}
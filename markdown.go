@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+var markdownPath = flag.String("markdown", "", "check the links in this Markdown file, or in the .md files under this directory, instead of crawling -root")
+
+var md = goldmark.New(goldmark.WithParserOptions(parser.WithAutoHeadingID()))
+
+var (
+	mdIDsMu sync.Mutex
+	mdIDs   = make(map[string]bool) // .md files whose heading ids are in fragExists
+)
+
+// checkMarkdown checks the links in the Markdown file or directory at
+// path. Relative links are checked against the filesystem, including
+// fragments naming headings in other Markdown files, and absolute links
+// are checked over HTTP without being crawled.
+func checkMarkdown(path string) {
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(file, ".md") {
+			checkMarkdownFile(file)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("reading Markdown: %v", err)
+	}
+}
+
+func checkMarkdownFile(file string) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Printf("ERROR: reading %s: %v", file, err)
+		return
+	}
+	doc := md.Parser().Parse(text.NewReader(src))
+	source := fileURL(file)
+	if *verbose {
+		log.Printf("Checking %s", file)
+	}
+	noteMarkdownIDs(file, doc)
+
+	var dests []string
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			dests = append(dests, string(n.Destination))
+		case *ast.Image:
+			dests = append(dests, string(n.Destination))
+		case *ast.AutoLink:
+			if n.AutoLinkType == ast.AutoLinkURL {
+				dests = append(dests, string(n.URL(src)))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, dest := range dests {
+		u, err := url.Parse(dest)
+		if err != nil {
+			addProblem(kindFetch, dest, err.Error())
+			continue
+		}
+		switch {
+		case u.Scheme == "http" || u.Scheme == "https":
+			followLink(source, dest, true)
+		case u.Scheme == "" && u.Host == "":
+			checkLocalLink(file, source, u)
+		}
+	}
+}
+
+// checkLocalLink checks that the file linked to by u from the Markdown
+// file file exists, and that it has any linked fragment.
+func checkLocalLink(file, source string, u *url.URL) {
+	target := file
+	if u.Path != "" {
+		target = filepath.Join(filepath.Dir(file), filepath.FromSlash(u.Path))
+	}
+	dest := fileURL(target)
+	noteLinkSource(dest, source)
+
+	if _, err := os.Stat(target); err != nil {
+		addProblem(kindFile, dest, "file not found")
+		return
+	}
+	if u.Fragment == "" || !strings.HasSuffix(target, ".md") {
+		return
+	}
+	mdIDsMu.Lock()
+	parsed := mdIDs[target]
+	mdIDsMu.Unlock()
+	if !parsed {
+		if src, err := ioutil.ReadFile(target); err == nil {
+			noteMarkdownIDs(target, md.Parser().Parse(text.NewReader(src)))
+		}
+	}
+	noteNeededFrag(urlFrag{dest, u.Fragment}, source)
+}
+
+// noteMarkdownIDs records the generated ids of the headings in doc.
+func noteMarkdownIDs(file string, doc ast.Node) {
+	mdIDsMu.Lock()
+	mdIDs[file] = true
+	mdIDsMu.Unlock()
+	page := fileURL(file)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if h, ok := n.(*ast.Heading); ok && entering {
+			if id, ok := h.AttributeString("id"); ok {
+				if id, ok := id.([]byte); ok {
+					noteFragExists(urlFrag{page, string(id)})
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// fileURL returns the file: URL for the named file.
+func fileURL(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String()
+}
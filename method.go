@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var method = flag.String("method", "GET", "HTTP method used to check the links that aren't crawled, such as external links and assets, e.g. HEAD, or OPTIONS or POST for API endpoints; pages are always crawled with GET")
+
+// A methodOverride is a -method-for: the method to check URLs matching rx
+// with.
+type methodOverride struct {
+	method string
+	rx     *regexp.Regexp
+}
+
+var (
+	methodFor       headerFlag
+	methodOverrides []methodOverride // compiled -method-for, in order
+)
+
+func init() {
+	flag.Var(&methodFor, "method-for", `"METHOD=regexp": check the links matching the regexp that aren't crawled with METHOD rather than -method; may be repeated, and the first match wins`)
+}
+
+// compileMethods parses the -method-for overrides.
+func compileMethods() error {
+	for _, m := range methodFor {
+		i := strings.Index(m, "=")
+		if i <= 0 {
+			return fmt.Errorf(`-method-for %q must be "METHOD=regexp"`, m)
+		}
+		rx, err := regexp.Compile(m[i+1:])
+		if err != nil {
+			return fmt.Errorf("-method-for %q: %v", m, err)
+		}
+		methodOverrides = append(methodOverrides, methodOverride{strings.ToUpper(m[:i]), rx})
+	}
+	return nil
+}
+
+// requestMethod returns the method to request url with. Pages crawled for
+// their links or fetched for their ids are got with GET, since their
+// bodies are needed; -method and -method-for are for the URLs only
+// checked.
+func requestMethod(url string) string {
+	if checkOnly, onlyIDs := crawlMode(url); onlyIDs || isInternal(url) && !checkOnly {
+		return "GET"
+	}
+	for _, m := range methodOverrides {
+		if m.rx.MatchString(url) {
+			return m.method
+		}
+	}
+	return strings.ToUpper(*method)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestMethod checks that with -method=HEAD the pages crawled are still got
+// with GET, so a broken link two pages from the root is found, and that
+// the links only checked are requested with HEAD.
+func TestMethod(t *testing.T) {
+	var mu sync.Mutex
+	methods := make(map[string]string) // path -> method
+	handler := func(pages map[string]string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			methods[r.Host+r.URL.Path] = r.Method
+			mu.Unlock()
+			body, ok := pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, body)
+		})
+	}
+	ext := httptest.NewServer(handler(map[string]string{"/": "external"}))
+	defer ext.Close()
+	ts := httptest.NewServer(handler(map[string]string{
+		"/":  `<!doctype html><title>root</title><a href="/a">a</a>`,
+		"/a": `<!doctype html><title>a</title><a href="/gone">gone</a><a href="` + ext.URL + `/">external</a>`,
+	}))
+	defer ts.Close()
+
+	data := crawlTest(t, ts.URL, map[string]string{"method": "HEAD"})
+	if want := []string{ts.URL + "/gone"}; !reflect.DeepEqual(problemURLs(data.Problems), want) {
+		t.Errorf("problems %v, want %v", problemURLs(data.Problems), want)
+	}
+	host := func(s *httptest.Server) string { return s.Listener.Addr().String() }
+	want := map[string]string{
+		host(ts) + "/":     "GET",
+		host(ts) + "/a":    "GET",
+		host(ts) + "/gone": "GET",
+		host(ext) + "/":    "HEAD",
+	}
+	if !reflect.DeepEqual(methods, want) {
+		t.Errorf("requests %v, want %v", methods, want)
+	}
+}
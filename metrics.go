@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsAddr = flag.String("metrics-addr", "", "serve Prometheus metrics at /metrics on this address while crawling")
+
+var (
+	pagesCrawled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "linkcheck_pages_crawled_total",
+		Help: "Pages parsed for links and ids.",
+	})
+	linksChecked = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "linkcheck_links_checked_total",
+		Help: "URLs fetched.",
+	})
+	errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "linkcheck_errors_total",
+		Help: "Problems found, by kind.",
+	}, []string{"kind"})
+	inFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "linkcheck_requests_in_flight",
+		Help: "Requests currently being made.",
+	})
+	latency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "linkcheck_response_seconds",
+		Help:    "Time until response headers were received.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pagesCrawled, linksChecked, errorsTotal, inFlight, latency)
+}
+
+// serveMetrics serves /metrics on addr. It doesn't return.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var enforceMIME = flag.Bool("enforce-mime", false, "warn about links to files whose Content-Type doesn't match their extension, e.g. a .pdf that isn't application/pdf, as when an error page is served with a 200")
+
+// extensionTypes are the media types allowed for files with each
+// extension, with -enforce-mime. Other extensions aren't checked.
+var extensionTypes = map[string][]string{
+	".css":   {"text/css"},
+	".csv":   {"text/csv"},
+	".gif":   {"image/gif"},
+	".ico":   {"image/x-icon", "image/vnd.microsoft.icon"},
+	".jpeg":  {"image/jpeg"},
+	".jpg":   {"image/jpeg"},
+	".js":    {"text/javascript", "application/javascript", "application/x-javascript"},
+	".json":  {"application/json"},
+	".mp3":   {"audio/mpeg"},
+	".mp4":   {"video/mp4"},
+	".pdf":   {"application/pdf"},
+	".png":   {"image/png"},
+	".svg":   {"image/svg+xml"},
+	".txt":   {"text/plain"},
+	".webm":  {"video/webm"},
+	".webp":  {"image/webp"},
+	".woff":  {"font/woff", "application/font-woff"},
+	".woff2": {"font/woff2"},
+	".xml":   {"application/xml", "text/xml"},
+	".zip":   {"application/zip"},
+}
+
+// checkMIME warns if the Content-Type ct of the file at rawurl isn't one
+// allowed for its extension.
+func checkMIME(rawurl, ct string) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	want, ok := extensionTypes[ext]
+	if !ok {
+		return
+	}
+	mt, _, _ := mime.ParseMediaType(ct)
+	for _, t := range want {
+		if mt == t {
+			return
+		}
+	}
+	addWarning(rawurl, fmt.Sprintf("%s file served as %q, not %s", ext, ct, strings.Join(want, " or ")))
+}
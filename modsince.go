@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+var modifiedSince = flag.String("modified-since", "", "date or RFC 3339 time; internal pages whose Last-Modified header (checked with a HEAD request) is older are checked but not crawled for their links or ids; pages without Last-Modified are crawled as usual")
+
+var (
+	modifiedSinceTime time.Time               // parsed -modified-since, zero if unset
+	unmodifiedPages   = make(map[string]bool) // pages not crawled because of -modified-since, guarded by mu
+)
+
+// parseModifiedSince parses -modified-since, in any of the formats
+// allowed in sitemap <lastmod>s.
+func parseModifiedSince() error {
+	if *modifiedSince == "" {
+		return nil
+	}
+	for _, layout := range lastmodLayouts {
+		if t, err := time.Parse(layout, *modifiedSince); err == nil {
+			modifiedSinceTime = t
+			return nil
+		}
+	}
+	return fmt.Errorf("-modified-since %q isn't a date or RFC 3339 time", *modifiedSince)
+}
+
+// unmodified reports whether a HEAD request for the page at url succeeds
+// with a Last-Modified header no later than -modified-since, in which case
+// it's recorded as not needing to be crawled. If the request fails or
+// redirects, or there's no Last-Modified, the page is fetched as usual.
+func unmodified(url string, jar http.CookieJar) bool {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return false
+	}
+	authorize(req)
+	if jar != nil {
+		for _, c := range jar.Cookies(req.URL) {
+			req.AddCookie(c)
+		}
+	}
+	linksChecked.Inc()
+	res, err := roundTrip(req)
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	if jar != nil {
+		jar.SetCookies(req.URL, res.Cookies())
+	}
+	if res.StatusCode != 200 || res.Header.Get("Last-Modified") == "" {
+		return false
+	}
+	modified, err := http.ParseTime(res.Header.Get("Last-Modified"))
+	if err != nil {
+		log.Printf("parsing Last-Modified of %s: %v", url, err)
+		return false
+	}
+	if modified.After(modifiedSinceTime) {
+		return false
+	}
+	if *verbose {
+		log.Printf("not crawling %s, unmodified since %s", url, modified.Format(time.RFC3339))
+	}
+	mu.Lock()
+	unmodifiedPages[url] = true
+	mu.Unlock()
+	return true
+}
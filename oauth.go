@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+var (
+	oauthTokenURL     = flag.String("oauth-token-url", "", "OAuth2 token endpoint; get a token with the client credentials grant and send it as a bearer token on requests to the root's host")
+	oauthClientID     = flag.String("oauth-client-id", "", "client ID for -oauth-token-url")
+	oauthClientSecret = flag.String("oauth-client-secret", "", "client secret for -oauth-token-url; may be a ${VAR} reference to an environment variable")
+	oauthScopes       = flag.String("oauth-scopes", "", "comma-separated scopes to request with -oauth-token-url")
+)
+
+// oauthTokens gets and refreshes the -oauth-token-url token, nil if unset.
+var oauthTokens oauth2.TokenSource
+
+// setupOAuth prepares the token source for -oauth-token-url. The token
+// isn't fetched until the first request to the site.
+func setupOAuth() {
+	if *oauthTokenURL == "" {
+		return
+	}
+	c := &clientcredentials.Config{
+		ClientID:     *oauthClientID,
+		ClientSecret: *oauthClientSecret,
+		TokenURL:     *oauthTokenURL,
+	}
+	for _, s := range strings.Split(*oauthScopes, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			c.Scopes = append(c.Scopes, s)
+		}
+	}
+	oauthTokens = c.TokenSource(context.Background())
+}
+
+// authorizeOAuth adds the current -oauth-token-url token to req, which is
+// to the root's host.
+func authorizeOAuth(req *http.Request) {
+	if oauthTokens == nil {
+		return
+	}
+	tok, err := oauthTokens.Token()
+	if err != nil {
+		log.Printf("getting OAuth2 token: %v", err)
+		return
+	}
+	tok.SetAuthHeader(req)
+}
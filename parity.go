@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var checkWWWParity = flag.Bool("check-www-parity", false, "also request each internal URL on the root's www or apex host, warning where the two give different statuses, as when they're served from different places; roughly doubles the requests for internal URLs")
+
+// alternateHost returns the www form of an apex host, or the apex form of
+// a www host, or "" for hosts without one, like IP addresses and localhost.
+func alternateHost(host string) string {
+	name, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		name, port = h, ":"+p
+	}
+	if net.ParseIP(strings.Trim(name, "[]")) != nil || !strings.Contains(name, ".") {
+		return ""
+	}
+	if apex := strings.TrimPrefix(name, "www."); apex != name {
+		return apex + port
+	}
+	return "www." + name + port
+}
+
+// checkParity requests rawurl on the alternate host, following redirects,
+// and warns if that doesn't get status, the status of rawurl itself. A
+// redirect back to the root's host is how it should be.
+func checkParity(rawurl string, status int) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return
+	}
+	alt := alternateHost(u.Host)
+	if alt == "" {
+		return
+	}
+	u.Host = alt
+	method := requestMethod(rawurl)
+	for redirects := 0; ; redirects++ {
+		if redirects == 10 {
+			addWarning(rawurl, fmt.Sprintf("too many redirects on %s", alt))
+			return
+		}
+		req, err := http.NewRequest(method, u.String(), nil)
+		if err != nil {
+			return
+		}
+		authorize(req)
+		linksChecked.Inc()
+		res, err := roundTrip(req)
+		if err != nil {
+			addWarning(rawurl, fmt.Sprintf("%s on %s failed: %v", method, alt, err))
+			return
+		}
+		res.Body.Close()
+		loc, err := res.Location()
+		if err != nil || res.StatusCode < 300 || res.StatusCode > 399 {
+			if res.StatusCode != status {
+				addWarning(rawurl, fmt.Sprintf("%s on %s gives %d, not %d", method, alt, res.StatusCode, status))
+			}
+			return
+		}
+		if loc.Host == base.Host {
+			return
+		}
+		u = loc
+	}
+}
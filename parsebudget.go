@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+var parseBudget = flag.Duration("crawl-budget-time-per-page", 0, "maximum time to spend parsing a page's HTML; pages that take longer are skipped with a warning (0 means no limit)")
+
+var errParseBudget = errors.New("parse budget exceeded")
+
+// deadlineReader reads from r until the deadline, then fails, so that an
+// abandoned parse stops soon after.
+type deadlineReader struct {
+	r        io.Reader
+	deadline time.Time
+}
+
+func (d deadlineReader) Read(p []byte) (int, error) {
+	if time.Now().After(d.deadline) {
+		return 0, errParseBudget
+	}
+	// Small reads, so the deadline is checked as parsing goes.
+	if len(p) > 4096 {
+		p = p[:4096]
+	}
+	return d.r.Read(p)
+}
+
+// parseHTML parses body, failing with errParseBudget if it takes longer
+// than the -crawl-budget-time-per-page.
+func parseHTML(body string) (*html.Node, error) {
+	if *parseBudget <= 0 {
+		return html.Parse(strings.NewReader(body))
+	}
+	type result struct {
+		doc *html.Node
+		err error
+	}
+	c := make(chan result, 1)
+	go func() {
+		doc, err := html.Parse(deadlineReader{strings.NewReader(body), time.Now().Add(*parseBudget)})
+		c <- result{doc, err}
+	}()
+	select {
+	case r := <-c:
+		return r.doc, r.err
+	case <-time.After(*parseBudget):
+		return nil, errParseBudget
+	}
+}
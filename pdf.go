@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+
+	"rsc.io/pdf"
+)
+
+var checkPDFLinks = flag.Bool("check-pdf-links", false, "also check the URLs of the link annotations in internal PDF documents")
+
+// pdfLinks returns the URIs of the link annotations in the PDF document
+// data.
+func pdfLinks(data []byte) (links []string, err error) {
+	// The pdf package panics on some malformed documents.
+	defer func() {
+		if r := recover(); r != nil {
+			links, err = nil, fmt.Errorf("reading PDF: %v", r)
+		}
+	}()
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i := 1; i <= r.NumPage(); i++ {
+		annots := r.Page(i).V.Key("Annots")
+		for j := 0; j < annots.Len(); j++ {
+			a := annots.Index(j)
+			if a.Key("Subtype").Name() != "Link" {
+				continue
+			}
+			action := a.Key("A")
+			if action.Key("S").Name() != "URI" {
+				continue
+			}
+			if uri := action.Key("URI").RawString(); uri != "" && !seen[uri] {
+				seen[uri] = true
+				links = append(links, uri)
+			}
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"time"
+)
+
+var (
+	pprofAddr = flag.String("pprof", "", "serve net/http/pprof profiles on this address (e.g. localhost:6060) while crawling")
+
+	memProfileDir      = flag.String("mem-profile-dir", "", "write a heap profile to this directory every -mem-profile-interval while crawling, to see whether memory grows on large crawls")
+	memProfileInterval = flag.Duration("mem-profile-interval", time.Minute, "time between -mem-profile-dir heap profiles")
+)
+
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// writeHeapProfiles writes a heap profile named for the time to dir every
+// interval, forever.
+func writeHeapProfiles(dir string, interval time.Duration) {
+	for range time.Tick(interval) {
+		name := filepath.Join(dir, "heap-"+time.Now().Format("20060102T150405")+".pprof")
+		if err := writeHeapProfile(name); err != nil {
+			log.Printf("writing heap profile: %v", err)
+		}
+	}
+}
+
+func writeHeapProfile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	// The profile is as of the last GC, so make it now.
+	runtime.GC()
+	err = runtimepprof.WriteHeapProfile(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var acceptRangesCheck = flag.Bool("accept-ranges-check", false, "check links to downloads (.zip, .dmg, .iso, and the like) with a one-byte range request rather than downloading them, reporting files that don't support ranges or are empty")
+
+// downloadExts are the extensions of the files checked with a range
+// request with -accept-ranges-check.
+var downloadExts = map[string]bool{
+	".7z": true, ".apk": true, ".bz2": true, ".deb": true, ".dmg": true,
+	".exe": true, ".gz": true, ".img": true, ".iso": true, ".jar": true,
+	".mov": true, ".mp3": true, ".mp4": true, ".msi": true, ".pkg": true,
+	".rpm": true, ".tar": true, ".tgz": true, ".webm": true, ".xz": true,
+	".zip": true,
+}
+
+// isDownload reports whether rawurl links to a downloadable file, going by
+// its extension.
+func isDownload(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	return downloadExts[strings.ToLower(path.Ext(u.Path))]
+}
+
+// checkRange checks the response to a range request for the first byte of
+// the download at url. A server not supporting ranges sends the whole file
+// with a 200, which is only a warning; a 416, or a 200 without content,
+// means the file is empty.
+func checkRange(url string, res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if res.ContentLength == 0 {
+			addProblem(kindDownload, url, "download is empty")
+		} else {
+			addWarning(url, "download doesn't support range requests")
+		}
+		return nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		addProblem(kindDownload, url, "download is empty")
+		return nil
+	default:
+		return statusError{res.StatusCode, res.Status}
+	}
+
+	// Content-Range is "bytes 0-0/size", where size may be "*" if unknown.
+	cr := res.Header.Get("Content-Range")
+	i := strings.LastIndex(cr, "/")
+	if !strings.HasPrefix(cr, "bytes 0-0/") || i < 0 {
+		addProblem(kindDownload, url, fmt.Sprintf("unexpected Content-Range %q for the first byte", cr))
+		return nil
+	}
+	if size, err := strconv.ParseInt(cr[i+1:], 10, 64); cr[i+1:] != "*" && (err != nil || size <= 0) {
+		addProblem(kindDownload, url, fmt.Sprintf("unexpected size in Content-Range %q", cr))
+		return nil
+	}
+	if res.ContentLength > 1 {
+		addProblem(kindDownload, url, fmt.Sprintf("Content-Length %d for a one-byte range", res.ContentLength))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+)
+
+var (
+	requireReached headerFlag
+	requiredRxs    []*regexp.Regexp        // compiled -require-reached
+	reached        = make(map[string]bool) // URLs crawled without error, with -require-reached or -recheck-failures-only; guarded by mu
+)
+
+var minPages = flag.Int("min-pages", 0, "exit with status 3 if fewer than this many pages on the site are crawled for their links, as when a wrong -root or -exclude, or a site built by JavaScript, means almost nothing was checked")
+
+// linkedPages counts the internal pages whose links were read, for
+// -min-pages. It's updated atomically.
+var linkedPages int64
+
+func init() {
+	flag.Var(&requireReached, "require-reached", "regexp of URLs, e.g. critical pages like checkout or login, at least one of which must be crawled without error; may be repeated")
+}
+
+// compileRequired parses the -require-reached regexps.
+func compileRequired() error {
+	for _, r := range requireReached {
+		rx, err := regexp.Compile(r)
+		if err != nil {
+			return fmt.Errorf("-require-reached %q: %v", r, err)
+		}
+		requiredRxs = append(requiredRxs, rx)
+	}
+	return nil
+}
+
+// noteReached records that url was crawled without error.
+func noteReached(url string) {
+	mu.Lock()
+	reached[url] = true
+	mu.Unlock()
+}
+
+// checkReached reports each -require-reached regexp that no URL crawled
+// without error matched, as when a navigation change orphans a page.
+func checkReached() {
+	for _, rx := range requiredRxs {
+		found := false
+		for url := range reached {
+			if rx.MatchString(url) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addProblem(kindUnreached, rx.String(), "no URL matching -require-reached was reached")
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+var recheckFile = flag.String("recheck-failures-only", "", "JSON file of the URLs found OK by previous crawls, updated after each crawl; links to them are trusted rather than checked again, so only failures and new links are fetched (pages are still crawled for their links)")
+
+// trusted are the URLs loaded from -recheck-failures-only.
+var trusted map[string]bool
+
+// loadTrusted loads the -recheck-failures-only file. It's fine if it
+// doesn't exist yet, as on the first crawl.
+func loadTrusted(file string) error {
+	trusted = make(map[string]bool)
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var urls []string
+	if err := json.Unmarshal(b, &urls); err != nil {
+		return err
+	}
+	for _, u := range urls {
+		trusted[u] = true
+	}
+	return nil
+}
+
+// isTrusted reports whether url needn't be fetched: it was OK last time,
+// and it's only being checked, not crawled for its links or fetched for
+// its ids.
+func isTrusted(url string, checkOnly, onlyIDs bool) bool {
+	if !trusted[url] || onlyIDs {
+		return false
+	}
+	if isInternal(url) {
+		return checkOnly
+	}
+	return !hostMatches(url, allowFragHosts)
+}
+
+// writeTrusted writes the URLs crawled without error to the
+// -recheck-failures-only file, along with those trusted before that this
+// crawl didn't come across, as when it was stopped early.
+func writeTrusted(file string) error {
+	urls := []string{}
+	for u := range reached {
+		urls = append(urls, u)
+	}
+	for u := range trusted {
+		if !isCrawled(u) {
+			urls = append(urls, u)
+		}
+	}
+	sort.Strings(urls)
+	b, err := json.MarshalIndent(urls, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0666)
+}
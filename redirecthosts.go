@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+)
+
+// allowedRedirectHosts are the hosts redirects may lead to, with
+// -allowed-redirect-hosts.
+var allowedRedirectHosts listFlag
+
+func init() {
+	flag.Var(&allowedRedirectHosts, "allowed-redirect-hosts", "hosts (and their subdomains) that links may redirect to, besides the root's host and the link's own; report redirects anywhere else, as from an open redirect or a hijacked link; may be repeated or comma-separated")
+}
+
+// unexpectedRedirect reports whether a redirect from u to target leaves
+// the -allowed-redirect-hosts.
+func unexpectedRedirect(u, target *url.URL) bool {
+	if len(allowedRedirectHosts) == 0 || target.Host == u.Host || target.Host == base.Host {
+		return false
+	}
+	return matchingHost(target.String(), allowedRedirectHosts) == ""
+}
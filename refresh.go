@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var respectMetaRefresh = flag.Bool("respect-meta-refresh", false, `follow <meta http-equiv="refresh"> redirects; immediate ones count against -max-redirects`)
+
+// metaRefresh returns the delay in seconds and target URL of n if it's a
+// <meta http-equiv="refresh"> element with a URL, such as
+// content="0; url=/new/".
+func metaRefresh(n *html.Node) (delay float64, ref string, ok bool) {
+	if n.Type != html.ElementNode || n.Data != "meta" || !strings.EqualFold(attr(n, "http-equiv"), "refresh") {
+		return 0, "", false
+	}
+	content := attr(n, "content")
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		// Just a delay, reloading the page.
+		return 0, "", false
+	}
+	delay, err := strconv.ParseFloat(strings.TrimSpace(content[:i]), 64)
+	if err != nil {
+		return 0, "", false
+	}
+	ref = strings.TrimSpace(content[i+1:])
+	if len(ref) >= 4 && strings.EqualFold(ref[:3], "url") {
+		if rest := strings.TrimSpace(ref[3:]); strings.HasPrefix(rest, "=") {
+			ref = strings.TrimSpace(rest[1:])
+		}
+	}
+	ref = strings.Trim(ref, `'"`)
+	if ref == "" {
+		return 0, "", false
+	}
+	return delay, ref, true
+}
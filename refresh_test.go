@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestMetaRefresh(t *testing.T) {
+	tests := []struct {
+		in    string
+		delay float64
+		ref   string
+		ok    bool
+	}{
+		{`<meta http-equiv="refresh" content="0; url=/new/">`, 0, "/new/", true},
+		{`<meta http-equiv="Refresh" content="5;URL='later.html'">`, 5, "later.html", true},
+		{`<meta http-equiv="refresh" content="1, next.html">`, 1, "next.html", true},
+		{`<meta http-equiv="refresh" content="30">`, 0, "", false},
+		{`<meta http-equiv="refresh" content="soon; url=x.html">`, 0, "", false},
+		{`<meta name="refresh" content="0; url=x.html">`, 0, "", false},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var delay float64
+		var ref string
+		var ok bool
+		var f func(*html.Node)
+		f = func(n *html.Node) {
+			if d, r, o := metaRefresh(n); o {
+				delay, ref, ok = d, r, o
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				f(c)
+			}
+		}
+		f(doc)
+		if delay != tt.delay || ref != tt.ref || ok != tt.ok {
+			t.Errorf("metaRefresh(%s) = %v, %q, %v, want %v, %q, %v", tt.in, delay, ref, ok, tt.delay, tt.ref, tt.ok)
+		}
+	}
+}
+
+// TestRespectMetaRefresh crawls a site with an immediate and a delayed
+// meta refresh, to a page and to a missing page.
+func TestRespectMetaRefresh(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata/refresh")))
+	defer ts.Close()
+
+	data := crawlTest(t, ts.URL, map[string]string{"respect-meta-refresh": "true"})
+	if want := []string{ts.URL + "/gone.html"}; !reflect.DeepEqual(problemURLs(data.Problems), want) {
+		t.Errorf("with -respect-meta-refresh: problems %v, want %v", problemURLs(data.Problems), want)
+	}
+	if data.Checked != 5 {
+		t.Errorf("with -respect-meta-refresh: checked %d URLs, want 5", data.Checked)
+	}
+	data = crawlTest(t, ts.URL, nil)
+	if len(data.Problems) != 0 || data.Checked != 3 {
+		t.Errorf("without -respect-meta-refresh: checked %d URLs with problems %v, want 3 without", data.Checked, problemURLs(data.Problems))
+	}
+}
@@ -0,0 +1,45 @@
+//go:build render
+// +build render
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const renderSupported = true
+
+var (
+	browserOnce sync.Once
+	browserCtx  context.Context
+	browserErr  error
+)
+
+// renderPage loads url in a headless Chrome tab and returns the rendered
+// DOM as HTML. A single browser is started on first use and shared by all
+// crawlers.
+func renderPage(url string) (string, error) {
+	browserOnce.Do(func() {
+		browserCtx, _ = chromedp.NewContext(context.Background())
+		browserErr = chromedp.Run(browserCtx)
+	})
+	if browserErr != nil {
+		return "", browserErr
+	}
+
+	ctx, cancel := chromedp.NewContext(browserCtx)
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var html string
+	err := chromedp.Run(ctx,
+		chromedp.Navigate(url),
+		chromedp.OuterHTML("html", &html, chromedp.ByQuery),
+	)
+	return html, err
+}
@@ -0,0 +1,14 @@
+//go:build !render
+// +build !render
+
+package main
+
+import "errors"
+
+// renderSupported is false unless linkcheck is built with -tags render,
+// which pulls in chromedp.
+const renderSupported = false
+
+func renderPage(url string) (string, error) {
+	return "", errors.New("built without render support")
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+var (
+	reportTmpl   = flag.String("report-template", "", `template for the report: "markdown", "html", or the path to a text/template file`)
+	groupBy      = flag.String("group-by", "", `group errors in the text report by "source" page or by "target" URL`)
+	summaryOnly  = flag.Bool("summary-only", false, "only print the counts of errors and warnings in the text report, not each one")
+	reportOK     = flag.Bool("report-ok", false, "also list the URLs checked without problems")
+	format       = flag.String("format", "text", `report format: "text", "json", "ndjson" (a JSON object per page as it's crawled, then the report), "tap" (a Test Anything Protocol test per URL), "junit" (a JUnit XML test case per URL), or "html" (a page of broken links grouped by the page linking to them)`)
+	streamErrors = flag.Bool("stream-errors", false, "write each error as soon as it's found rather than all at the end, for very broken sites; only the pages found linking to it so far are listed")
+	reportDir    = flag.String("report-dir", "", "also write the report as report.txt, report.json, and report.xml (JUnit) in this directory")
+
+	urlsOnly = flag.Bool("output-urls-only", false, "instead of the report, print just the broken URLs, once each, for scripts")
+)
+
+// A problem is a broken link or missing fragment, or a warning about a
+// link.
+type problem struct {
+	Kind    string   `json:"kind"`               // what sort of problem, e.g. "status"
+	URL     string   `json:"url"`                // the URL with the problem, without fragment
+	Frag    string   `json:"fragment,omitempty"` // the missing fragment, if any
+	Err     string   `json:"error"`              // what's wrong
+	Sources []string `json:"sources"`            // pages linking to URL
+
+	Archive    string `json:"archive,omitempty"`    // a Wayback Machine snapshot of URL, with -suggest-wayback
+	Suggestion string `json:"suggestion,omitempty"` // the closest id to Frag, with -fuzzy-fragment-suggestions
+}
+
+// sortProblems sorts ps by their first source, then URL, fragment, and
+// kind, so reports are the same from run to run despite map iteration and
+// crawl order.
+func sortProblems(ps []problem) {
+	for _, p := range ps {
+		sort.Strings(p.Sources)
+	}
+	sort.SliceStable(ps, func(i, j int) bool {
+		a, b := ps[i], ps[j]
+		if sa, sb := firstSource(a), firstSource(b); sa != sb {
+			return sa < sb
+		}
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		if a.Frag != b.Frag {
+			return a.Frag < b.Frag
+		}
+		return a.Kind < b.Kind
+	})
+}
+
+func firstSource(p problem) string {
+	if len(p.Sources) == 0 {
+		return ""
+	}
+	return p.Sources[0]
+}
+
+func (p problem) String() string {
+	if p.Suggestion != "" {
+		return fmt.Sprintf("Missing fragment for %+v from %v, did you mean #%s?", urlFrag{p.URL, p.Frag}, p.Sources, p.Suggestion)
+	}
+	if p.Frag != "" {
+		return fmt.Sprintf("Missing fragment for %+v from %v", urlFrag{p.URL, p.Frag}, p.Sources)
+	}
+	if p.Archive != "" {
+		return fmt.Sprintf("Error on %s: %s (from %s), archived at %s", p.URL, p.Err, p.Sources, p.Archive)
+	}
+	return fmt.Sprintf("Error on %s: %s (from %s)", p.URL, p.Err, p.Sources)
+}
+
+// target returns the broken URL, including any fragment.
+func (p problem) target() string {
+	if p.Frag != "" {
+		return p.URL + "#" + p.Frag
+	}
+	return p.URL
+}
+
+func (p problem) warning() string {
+	return fmt.Sprintf("Warning on %s: %s (from %s)", p.URL, p.Err, p.Sources)
+}
+
+// reportData is the result of a crawl, as passed to report templates.
+type reportData struct {
+	Problems    []problem `json:"problems"`
+	Warnings    []problem `json:"warnings"`
+	Known       []problem `json:"known"`       // problems in the -baseline
+	Suppressed  int       `json:"suppressed"`  // problems not shown because of -max-errors
+	Streamed    int       `json:"streamed"`    // problems already written, with -stream-errors
+	Stopped     bool      `json:"stopped"`     // crawl was stopped early by -max-errors-stop or a signal
+	Interrupted bool      `json:"interrupted"` // crawl was stopped early by a signal
+	Partial     bool      `json:"partial"`     // a -checkpoint-interval report of a crawl in progress
+	Checked     int       `json:"checked"`     // URLs checked
+	Bytes       int64     `json:"bytes"`       // response body bytes downloaded
+
+	Statuses map[string]int `json:"statuses"` // responses by status code, or "timeout" or "error"
+
+	RedirectChains *chainStats      `json:"redirect_chains,omitempty"` // with -report-chain-length
+	Redirects      []redirectedLink `json:"redirects,omitempty"`       // links that redirect, with -report-redirects
+
+	OK      []okURL    `json:"ok,omitempty"`      // URLs checked without problems, with -report-ok
+	Slowest []slowURL  `json:"slowest,omitempty"` // URLs slowest to respond, with -slowest
+	Pages   []string   `json:"pages,omitempty"`   // the URLs fetched without error, with -diff or -report-ok
+	Diff    *crawlDiff `json:"diff,omitempty"`    // changes since the -diff crawl
+
+	ExternalHosts       []hostCount    `json:"external_hosts,omitempty"`       // hosts linked to, with -list-external-hosts
+	InconsistentAnchors []anchorText   `json:"inconsistent_anchors,omitempty"` // with -report-inconsistent-anchors
+	ExternalHTTP        []insecureHost `json:"external_http,omitempty"`        // with -report-external-without-https
+
+	Coverage []coverageRow `json:"coverage,omitempty"` // the sitemap URLs, with -sitemap-coverage
+
+	Results []pageResult `json:"-"` // the URLs crawled, with -format=tap or junit, -report-dir, -report-ok, or -sqlite
+
+	Unlisted map[string]bool `json:"-"` // URLs that couldn't be fetched or had a bad status, in problems streamed or suppressed
+}
+
+// writeReport writes the report in the -format, or using tmpl if it's set.
+func writeReport(w io.Writer, data reportData, tmpl *template.Template) error {
+	if *urlsOnly {
+		return writeURLs(w, data)
+	}
+	if tmpl != nil {
+		return tmpl.Execute(w, data)
+	}
+	return writeFormat(w, data, *format)
+}
+
+// writeURLs writes the URLs with problems, sorted, one per line. A
+// missing fragment is written with its URL.
+func writeURLs(w io.Writer, data reportData) error {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, p := range data.Problems {
+		if t := p.target(); !seen[t] {
+			seen[t] = true
+			urls = append(urls, t)
+		}
+	}
+	sort.Strings(urls)
+	for _, u := range urls {
+		if _, err := fmt.Fprintln(w, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportFiles are the files written to the -report-dir, by format.
+var reportFiles = []struct{ name, format string }{
+	{"report.txt", "text"},
+	{"report.json", "json"},
+	{"report.xml", "junit"},
+}
+
+// writeReportDir writes the report in each of the reportFiles formats to
+// dir, creating it if needed.
+func writeReportDir(dir string, data reportData) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, f := range reportFiles {
+		out, err := os.Create(filepath.Join(dir, f.name))
+		if err != nil {
+			return err
+		}
+		err = writeFormat(out, data, f.format)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("writing %s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+// writeFormat writes the report in the named format.
+func writeFormat(w io.Writer, data reportData, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	case "ndjson":
+		return writeNDJSON(w, struct {
+			Type string `json:"type"`
+			reportData
+		}{"report", data})
+	case "tap":
+		writeTAP(w, data)
+		return nil
+	case "junit":
+		return writeJUnit(w, data)
+	case "html":
+		return writeHTML(w, data)
+	}
+	writeText(w, data)
+	return nil
+}
+
+// A pageResult is the -format=ndjson record of a crawled URL.
+type pageResult struct {
+	Type   string   `json:"type"` // "page"
+	URL    string   `json:"url"`
+	Status int      `json:"status,omitempty"`
+	Error  string   `json:"error,omitempty"`
+	Links  []string `json:"links,omitempty"`
+
+	ContentType string `json:"content_type,omitempty"` // if it isn't HTML
+}
+
+// An okURL is a URL checked without problems, listed with -report-ok.
+type okURL struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"` // if it isn't HTML
+}
+
+// resourceType returns the Content-Type of fr if it isn't HTML, so that
+// links to, say, PDFs that return HTML error pages stand out.
+func resourceType(fr fetchResult) string {
+	if isHTMLType(fr.contentType) {
+		return ""
+	}
+	return fr.contentType
+}
+
+var ndjsonMu sync.Mutex // serializes -format=ndjson output
+
+// writePageResult writes the -format=ndjson record for url to stdout as
+// soon as it's crawled.
+func writePageResult(url string, fr fetchResult, err error) {
+	r := pageResult{Type: "page", URL: url, Status: fr.status, Links: fr.links, ContentType: resourceType(fr)}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := writeNDJSON(os.Stdout, r); err != nil {
+		log.Printf("writing result for %s: %v", url, err)
+	}
+}
+
+// okURLs returns the sorted URLs in data.Results that were fetched
+// without error and have no problems, known or not.
+func okURLs(data reportData) []okURL {
+	bad := make(map[string]bool)
+	for _, p := range data.Problems {
+		bad[p.URL] = true
+	}
+	for _, p := range data.Known {
+		bad[p.URL] = true
+	}
+	var ok []okURL
+	for _, r := range data.Results {
+		if r.Error == "" && !bad[r.URL] {
+			ok = append(ok, okURL{r.URL, r.ContentType})
+		}
+	}
+	sort.Slice(ok, func(i, j int) bool { return ok[i].URL < ok[j].URL })
+	return ok
+}
+
+// noteResult records the result of crawling url, for -format=tap or
+// junit, -report-dir, and -report-ok.
+func noteResult(url string, fr fetchResult, err error) {
+	r := pageResult{Type: "page", URL: url, Status: fr.status, ContentType: resourceType(fr)}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	problemsMu.Lock()
+	results = append(results, r)
+	problemsMu.Unlock()
+}
+
+// streamProblem writes p to stdout as it's found, with -stream-errors.
+func streamProblem(p problem) {
+	var err error
+	if *format == "ndjson" {
+		err = writeNDJSON(os.Stdout, struct {
+			Type string `json:"type"`
+			problem
+		}{"problem", p})
+	} else {
+		_, err = fmt.Println(p)
+	}
+	if err != nil {
+		log.Printf("writing error for %s: %v", p.URL, err)
+	}
+}
+
+func writeNDJSON(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ndjsonMu.Lock()
+	defer ndjsonMu.Unlock()
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// writeText writes the default plain text report.
+func writeText(w io.Writer, data reportData) {
+	if data.Diff != nil {
+		writeDiff(w, data.Diff)
+		fmt.Fprintf(w, "Checked %d URLs, downloaded %d bytes\n", data.Checked, data.Bytes)
+		return
+	}
+	if *summaryOnly {
+		fmt.Fprintf(w, "%d errors, %d warnings", len(data.Problems)+data.Streamed+data.Suppressed, len(data.Warnings))
+		if len(data.Known) > 0 {
+			fmt.Fprintf(w, ", %d known errors", len(data.Known))
+		}
+		if data.Stopped {
+			fmt.Fprint(w, " (crawl stopped early)")
+		}
+		fmt.Fprintf(w, "; checked %d URLs, downloaded %d bytes\n", data.Checked, data.Bytes)
+		if len(data.Statuses) > 0 {
+			fmt.Fprintf(w, "Responses: %s\n", statusSummary(data.Statuses))
+		}
+		if data.RedirectChains != nil {
+			writeChainStats(w, data.RedirectChains)
+		}
+		return
+	}
+	switch *groupBy {
+	case "source":
+		writeBySource(w, data.Problems)
+	case "target":
+		writeByTarget(w, data.Problems)
+	default:
+		for _, p := range data.Problems {
+			fmt.Fprintln(w, p)
+		}
+	}
+	for _, p := range data.Warnings {
+		fmt.Fprintln(w, p.warning())
+	}
+	for _, p := range data.Known {
+		fmt.Fprintf(w, "%v (known)\n", p)
+	}
+	for _, u := range data.OK {
+		if u.ContentType != "" {
+			fmt.Fprintf(w, "OK %s (%s)\n", u.URL, u.ContentType)
+		} else {
+			fmt.Fprintf(w, "OK %s\n", u.URL)
+		}
+	}
+	for _, u := range data.Slowest {
+		fmt.Fprintf(w, "Slow %s (%.3fs)\n", u.URL, u.Seconds)
+	}
+	for _, r := range data.Redirects {
+		fmt.Fprintln(w, r)
+	}
+	for _, h := range data.ExternalHosts {
+		fmt.Fprintf(w, "External host %s (%d links)\n", h.Host, h.Links)
+	}
+	for _, h := range data.ExternalHTTP {
+		fmt.Fprintf(w, "Insecure external host %s (%d http links): %s\n", h.Host, len(h.URLs), strings.Join(h.URLs, ", "))
+	}
+	for _, c := range data.Coverage {
+		reached := "reached"
+		if !c.Reached {
+			reached = "not reached"
+		}
+		status := strconv.Itoa(c.Status)
+		if c.Error != "" {
+			status = c.Error
+		}
+		fmt.Fprintf(w, "Sitemap URL %s: %s, %s, %d broken links\n", c.URL, reached, status, c.BrokenLinks)
+	}
+	for _, a := range data.InconsistentAnchors {
+		fmt.Fprintf(w, "Link text %q links to %d URLs: %s\n", a.Text, len(a.URLs), strings.Join(a.URLs, ", "))
+	}
+	if data.Suppressed > 0 {
+		fmt.Fprintf(w, "%d errors shown, %d more suppressed\n", len(data.Problems)+data.Streamed, data.Suppressed)
+	}
+	if n := countKind(data.Problems, kindTransient); n > 0 {
+		fmt.Fprintf(w, "%d errors may be transient network errors, listed in %s to check again\n", n, *retryLater)
+	}
+	if data.Partial {
+		fmt.Fprintln(w, "crawl in progress")
+	} else if data.Interrupted {
+		fmt.Fprintln(w, "crawl interrupted")
+	} else if data.Stopped {
+		fmt.Fprintf(w, "crawl stopped after %d errors\n", len(data.Problems)+data.Streamed)
+	}
+	if len(data.Statuses) > 0 {
+		fmt.Fprintf(w, "Responses: %s\n", statusSummary(data.Statuses))
+	}
+	if data.RedirectChains != nil {
+		writeChainStats(w, data.RedirectChains)
+	}
+	fmt.Fprintf(w, "Checked %d URLs, downloaded %d bytes\n", data.Checked, data.Bytes)
+}
+
+// A tapTest is a line of -format=tap output.
+type tapTest struct {
+	ok   bool
+	desc string
+	todo bool // a known problem, from the -baseline
+}
+
+// writeTAP writes a Test Anything Protocol test for each crawled URL,
+// failing if it has problems. Problems in the baseline are TODO tests, and
+// problems with URLs that weren't crawled, such as missing local files,
+// get a test of their own.
+func writeTAP(w io.Writer, data reportData) {
+	byURL := make(map[string][]problem)
+	for _, p := range data.Problems {
+		byURL[p.URL] = append(byURL[p.URL], p)
+	}
+	knownByURL := make(map[string][]problem)
+	for _, p := range data.Known {
+		knownByURL[p.URL] = append(knownByURL[p.URL], p)
+	}
+	crawledURLs := make(map[string]bool)
+	var tests []tapTest
+	sort.Slice(data.Results, func(i, j int) bool { return data.Results[i].URL < data.Results[j].URL })
+	for _, r := range data.Results {
+		crawledURLs[r.URL] = true
+		desc := r.URL
+		if r.Status != 0 {
+			desc += " " + strconv.Itoa(r.Status)
+		}
+		if r.ContentType != "" {
+			desc += " " + r.ContentType
+		}
+		switch {
+		case len(byURL[r.URL]) > 0:
+			tests = append(tests, tapTest{desc: desc + ": " + tapErrors(byURL[r.URL])})
+		case len(knownByURL[r.URL]) > 0:
+			tests = append(tests, tapTest{desc: desc + ": " + tapErrors(knownByURL[r.URL]), todo: true})
+		default:
+			tests = append(tests, tapTest{ok: true, desc: desc})
+		}
+	}
+	for _, p := range data.Problems {
+		if !crawledURLs[p.URL] {
+			tests = append(tests, tapTest{desc: p.target() + ": " + p.Err})
+		}
+	}
+	for _, p := range data.Known {
+		if !crawledURLs[p.URL] {
+			tests = append(tests, tapTest{desc: p.target() + ": " + p.Err, todo: true})
+		}
+	}
+
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%d\n", len(tests))
+	for i, t := range tests {
+		status := "not ok"
+		if t.ok {
+			status = "ok"
+		}
+		fmt.Fprintf(w, "%s %d - %s", status, i+1, t.desc)
+		if t.todo {
+			fmt.Fprint(w, " # TODO known")
+		}
+		fmt.Fprintln(w)
+	}
+	if data.Suppressed > 0 {
+		fmt.Fprintf(w, "# %d more errors suppressed\n", data.Suppressed)
+	}
+	if data.Stopped {
+		fmt.Fprintln(w, "# crawl stopped early")
+	}
+	if len(data.Statuses) > 0 {
+		fmt.Fprintf(w, "# responses: %s\n", statusSummary(data.Statuses))
+	}
+}
+
+// tapErrors describes problems on one line, for a TAP test.
+func tapErrors(problems []problem) string {
+	var errs []string
+	for _, p := range problems {
+		if p.Frag != "" {
+			errs = append(errs, "missing fragment #"+p.Frag)
+		} else {
+			errs = append(errs, p.Err)
+		}
+	}
+	return strings.Join(errs, "; ")
+}
+
+// bySource groups problems by the pages linking to them, returning the
+// pages sorted. Problems that aren't linked from any page are under "".
+func bySource(problems []problem) (map[string][]problem, []string) {
+	groups := make(map[string][]problem)
+	for _, p := range problems {
+		if len(p.Sources) == 0 {
+			groups[""] = append(groups[""], p)
+		}
+		for _, src := range p.Sources {
+			groups[src] = append(groups[src], p)
+		}
+	}
+	var srcs []string
+	for src := range groups {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	return groups, srcs
+}
+
+// writeBySource writes problems under a heading for each page linking to
+// them, so a page's broken links can be fixed together.
+func writeBySource(w io.Writer, problems []problem) {
+	groups, srcs := bySource(problems)
+	for _, src := range srcs {
+		if src == "" {
+			fmt.Fprintln(w, "(not linked)")
+		} else {
+			fmt.Fprintln(w, src)
+		}
+		for _, p := range groups[src] {
+			fmt.Fprintf(w, "    %s: %s\n", p.target(), p.Err)
+		}
+	}
+}
+
+// writeByTarget writes each problem followed by the pages linking to it.
+func writeByTarget(w io.Writer, problems []problem) {
+	for _, p := range problems {
+		fmt.Fprintf(w, "%s: %s\n", p.target(), p.Err)
+		for _, src := range p.Sources {
+			fmt.Fprintf(w, "    %s\n", src)
+		}
+	}
+}
+
+var builtinTemplates = map[string]string{
+	"markdown": markdownTemplate,
+	"html":     htmlTemplate,
+}
+
+var templateFuncs = template.FuncMap{
+	"join":     strings.Join,
+	"statuses": statusSummary,
+}
+
+// reportTemplate returns the template named by -report-template, or nil
+// for the default text report.
+func reportTemplate(name string) (*template.Template, error) {
+	if name == "" {
+		return nil, nil
+	}
+	text, ok := builtinTemplates[name]
+	if !ok {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+const markdownTemplate = `# Link check report
+
+{{len .Problems}} errors{{if .Suppressed}} ({{.Suppressed}} more suppressed){{end}}, {{len .Warnings}} warnings{{if .Known}}, {{len .Known}} known errors{{end}}. Checked {{.Checked}} URLs, downloaded {{.Bytes}} bytes.
+{{if .Statuses}}
+Responses: {{statuses .Statuses}}
+{{end}}
+{{- if .Stopped}}
+The crawl was stopped early.
+{{end}}
+{{- if .Problems}}
+## Errors
+
+| URL | Error | Linked from |
+| --- | ----- | ----------- |
+{{range .Problems}}| {{.URL}}{{if .Frag}}#{{.Frag}}{{end}} | {{.Err}} | {{join .Sources ", "}} |
+{{end}}{{end}}
+{{- if .Warnings}}
+## Warnings
+
+| URL | Warning | Linked from |
+| --- | ------- | ----------- |
+{{range .Warnings}}| {{.URL}} | {{.Err}} | {{join .Sources ", "}} |
+{{end}}{{end}}`
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Link check report</title>
+</head>
+<body>
+<h1>Link check report</h1>
+<p>{{len .Problems}} errors{{if .Suppressed}} ({{.Suppressed}} more suppressed){{end}}, {{len .Warnings}} warnings{{if .Known}}, {{len .Known}} known errors{{end}}. Checked {{.Checked}} URLs, downloaded {{.Bytes}} bytes.</p>
+{{- if .Statuses}}
+<p>Responses: {{statuses .Statuses | html}}</p>
+{{- end}}
+{{- if .Stopped}}
+<p>The crawl was stopped early.</p>
+{{- end}}
+{{- if .Problems}}
+<h2>Errors</h2>
+<table>
+<tr><th>URL</th><th>Error</th><th>Linked from</th></tr>
+{{- range .Problems}}
+<tr><td>{{.URL | html}}{{if .Frag}}#{{.Frag | html}}{{end}}</td><td>{{.Err | html}}</td><td>{{join .Sources ", " | html}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Warnings}}
+<h2>Warnings</h2>
+<table>
+<tr><th>URL</th><th>Warning</th><th>Linked from</th></tr>
+{{- range .Warnings}}
+<tr><td>{{.URL | html}}</td><td>{{.Err | html}}</td><td>{{join .Sources ", " | html}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`
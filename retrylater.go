@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+)
+
+var retryLater = flag.String("retry-later", "", `report URLs that failed with a network error that may not recur, such as a connection reset or timeout, as "transient" rather than broken, and write them to this file, one per line, to check again with -stdin`)
+
+// writeRetryLater writes the URLs of the transient problems in data to
+// file, one per line.
+func writeRetryLater(file string, data reportData) error {
+	var b strings.Builder
+	for _, p := range data.Problems {
+		if p.Kind == kindTransient {
+			b.WriteString(p.URL + "\n")
+		}
+	}
+	return ioutil.WriteFile(file, []byte(b.String()), 0666)
+}
+
+// countKind returns how many of ps are of the given kind.
+func countKind(ps []problem, kind string) int {
+	n := 0
+	for _, p := range ps {
+		if p.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	retryTransient = flag.Bool("retry", false, "retry a request once after a response with a transient status ("+defaultRetryStatuses+"), waiting for a short Retry-After first")
+	retryOnStatus  = flag.String("retry-on-status", "", `comma-separated status codes to retry a request once after, instead of -retry's, e.g. "403,429,503" for a site behind a CDN whose challenges answer 403`)
+)
+
+// defaultRetryStatuses are the status codes -retry retries after, without
+// -retry-on-status.
+const defaultRetryStatuses = "429,500,502,503,504"
+
+// maxRetryAfter is the longest Retry-After worth waiting for. A response
+// asking for a longer wait is taken as it is.
+const maxRetryAfter = 30 * time.Second
+
+var retryStatuses map[int]bool // parsed -retry-on-status
+
+// parseRetryStatuses parses -retry-on-status, or with only -retry uses
+// the defaultRetryStatuses. Without either, no status is retried.
+func parseRetryStatuses() error {
+	retryStatuses = make(map[int]bool)
+	codes := *retryOnStatus
+	if codes == "" && *retryTransient {
+		codes = defaultRetryStatuses
+	}
+	for _, s := range strings.Split(codes, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		code, err := strconv.Atoi(s)
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("-retry-on-status: bad status code %q", s)
+		}
+		retryStatuses[code] = true
+	}
+	return nil
+}
+
+// retryWait returns how long to wait before retrying after res, and
+// whether to retry at all.
+func retryWait(res *http.Response) (time.Duration, bool) {
+	if !retryStatuses[res.StatusCode] {
+		return 0, false
+	}
+	v := strings.TrimSpace(res.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, true
+	}
+	var wait time.Duration
+	if secs, err := strconv.Atoi(v); err == nil {
+		wait = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		wait = time.Until(t)
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, wait <= maxRetryAfter
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestRetryStatuses checks that no status is retried unless -retry or
+// -retry-on-status asks for it.
+func TestRetryStatuses(t *testing.T) {
+	defer func(retry bool, codes string) {
+		*retryTransient, *retryOnStatus = retry, codes
+		parseRetryStatuses()
+	}(*retryTransient, *retryOnStatus)
+	tests := []struct {
+		retry bool
+		codes string
+		want  map[int]bool
+	}{
+		{false, "", map[int]bool{}},
+		{true, "", map[int]bool{429: true, 500: true, 502: true, 503: true, 504: true}},
+		{false, "403, 429", map[int]bool{403: true, 429: true}},
+		{true, "403", map[int]bool{403: true}},
+	}
+	for _, tt := range tests {
+		*retryTransient, *retryOnStatus = tt.retry, tt.codes
+		if err := parseRetryStatuses(); err != nil {
+			t.Errorf("-retry=%v -retry-on-status=%q: %v", tt.retry, tt.codes, err)
+			continue
+		}
+		if !reflect.DeepEqual(retryStatuses, tt.want) {
+			t.Errorf("-retry=%v -retry-on-status=%q: retrying %v, want %v", tt.retry, tt.codes, retryStatuses, tt.want)
+		}
+	}
+	*retryOnStatus = "4o4"
+	if err := parseRetryStatuses(); err == nil {
+		t.Errorf("-retry-on-status=4o4: no error")
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+var respectRobotsMeta = flag.Bool("respect-robots-meta", false, "don't follow the links on pages with a robots <meta> tag or X-Robots-Tag header saying nofollow, only check the pages themselves")
+
+var robotsDelay = flag.Bool("crawl-delay-from-robots", false, "wait the Crawl-delay given in each host's robots.txt between requests to it, when it's longer than -delay")
+
+var respectRobotsTxt = flag.Bool("respect-robots-txt", false, "don't check or crawl URLs that their host's robots.txt disallows")
+
+// robotsUserAgent is the robots.txt user-agent linkcheck obeys, besides *.
+const robotsUserAgent = "linkcheck"
+
+// A hostRobots is what we know of a host's robots.txt, and when it may
+// next be requested.
+type hostRobots struct {
+	once sync.Once
+	robotsGroup
+
+	mu   sync.Mutex // held while waiting for next
+	next time.Time
+}
+
+var (
+	robotsMu sync.Mutex
+	robots   = make(map[string]*hostRobots) // scheme://host -> its robots.txt
+)
+
+// hostRobotsFor returns the robots.txt of u's host, fetching it the first
+// time.
+func hostRobotsFor(u *url.URL) *hostRobots {
+	origin := u.Scheme + "://" + u.Host
+	robotsMu.Lock()
+	r, ok := robots[origin]
+	if !ok {
+		r = new(hostRobots)
+		robots[origin] = r
+	}
+	robotsMu.Unlock()
+	r.once.Do(func() {
+		if body, err := fetchRobots(origin); err == nil {
+			r.robotsGroup = parseRobots(body)
+		}
+	})
+	return r
+}
+
+// fetchRobots returns the robots.txt at origin, or an error if it can't
+// be read.
+func fetchRobots(origin string) (io.Reader, error) {
+	req, err := http.NewRequest("GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	authorize(req)
+	res, err := roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, statusError{res.StatusCode, res.Status}
+	}
+	var b strings.Builder
+	if _, err := io.Copy(&b, io.LimitReader(countingReader{res.Body}, 1<<20)); err != nil {
+		return nil, err
+	}
+	return strings.NewReader(b.String()), nil
+}
+
+// A robotsGroup is the rules in robots.txt for a user agent.
+type robotsGroup struct {
+	delay time.Duration // Crawl-delay
+	rules []robotsRule
+}
+
+// A robotsRule is an Allow or Disallow line.
+type robotsRule struct {
+	allow bool
+	path  string         // the pattern as given, whose length is its precedence
+	rx    *regexp.Regexp // path, with its * and $ wildcards
+}
+
+// parseRobots returns the robots.txt group read from r for linkcheck, or
+// failing that for all user agents. Like other crawlers, it combines the
+// groups for the same user agent.
+func parseRobots(r io.Reader) robotsGroup {
+	groups := make(map[string]*robotsGroup)
+	var agents []string // of the current group
+	inRules := false
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents, inRules = nil, false
+			}
+			// A product token may be given with its version.
+			agent := strings.ToLower(val)
+			if i := strings.Index(agent, "/"); i >= 0 {
+				agent = agent[:i]
+			}
+			agents = append(agents, agent)
+			if groups[agent] == nil {
+				groups[agent] = new(robotsGroup)
+			}
+		case "crawl-delay":
+			inRules = true
+			secs, err := strconv.ParseFloat(val, 64)
+			if err != nil || secs < 0 {
+				continue
+			}
+			for _, a := range agents {
+				groups[a].delay = time.Duration(secs * float64(time.Second))
+			}
+		case "allow", "disallow":
+			inRules = true
+			if val == "" {
+				// An empty Disallow allows everything.
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", path: val, rx: robotsPattern(val)}
+			for _, a := range agents {
+				groups[a].rules = append(groups[a].rules, rule)
+			}
+		default:
+			inRules = true
+		}
+	}
+	if g, ok := groups[robotsUserAgent]; ok {
+		return *g
+	}
+	if g, ok := groups["*"]; ok {
+		return *g
+	}
+	return robotsGroup{}
+}
+
+// robotsPattern compiles a robots.txt path pattern, in which * matches
+// any characters and a final $ matches the end of the path.
+func robotsPattern(path string) *regexp.Regexp {
+	end := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+	parts := strings.Split(path, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if end {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allows reports whether g allows path, with its query. The rule with the
+// longest pattern matching path applies, and of rules as long, Allow.
+func (g robotsGroup) allows(path string) bool {
+	allow, longest := true, -1
+	for _, r := range g.rules {
+		if !r.rx.MatchString(path) {
+			continue
+		}
+		if n := len(r.path); n > longest || n == longest && r.allow {
+			allow, longest = r.allow, n
+		}
+	}
+	return allow
+}
+
+// robotsDisallowed reports whether the robots.txt of rawurl's host
+// disallows it.
+func robotsDisallowed(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return false
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return !hostRobotsFor(u).allows(path)
+}
+
+// waitForHost waits until the Crawl-delay of rawurl's host has passed
+// since the last request to it.
+func waitForHost(rawurl string) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return
+	}
+	r := hostRobotsFor(u)
+	if r.delay <= *delay {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if wait := time.Until(r.next); wait > 0 {
+		time.Sleep(wait)
+	}
+	r.next = time.Now().Add(r.delay)
+}
+
+// robotsNofollow reports whether robots directives, as in a robots <meta>
+// tag's content, include nofollow.
+func robotsNofollow(directives string) bool {
+	for _, d := range strings.Split(directives, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "nofollow" || d == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// metaNofollow reports whether n is a robots <meta> tag, for all robots or
+// for linkcheck, saying not to follow the page's links.
+func metaNofollow(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data != "meta" {
+		return false
+	}
+	name := attr(n, "name")
+	if !strings.EqualFold(name, "robots") && !strings.EqualFold(name, robotsUserAgent) {
+		return false
+	}
+	return robotsNofollow(attr(n, "content"))
+}
+
+// headerNofollow reports whether the X-Robots-Tag headers in h, for all
+// robots or for linkcheck, say not to follow the page's links. A header
+// may start with a user agent, as in "X-Robots-Tag: otherbot: nofollow".
+func headerNofollow(h http.Header) bool {
+	for _, v := range h.Values("X-Robots-Tag") {
+		if i := strings.Index(v, ":"); i > 0 && !strings.ContainsAny(v[:i], " ,") {
+			switch ua := strings.ToLower(v[:i]); ua {
+			case "unavailable_after", "max-snippet", "max-image-preview", "max-video-preview":
+				// A directive with a value, not a user agent.
+			default:
+				if ua != robotsUserAgent {
+					continue
+				}
+				v = v[i+1:]
+			}
+		}
+		if robotsNofollow(v) {
+			return true
+		}
+	}
+	return false
+}
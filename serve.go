@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	serveAddr = flag.String("serve", "", "run as a server on this address, recrawling every -interval and serving the latest report at /report and metrics at /metrics")
+	interval  = flag.Duration("interval", time.Hour, "time between crawls with -serve")
+)
+
+// A crawlResult is a finished crawl, as served by -serve.
+type crawlResult struct {
+	reportData
+	Finished time.Time     `json:"finished"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Gauges describing the last crawl, set by serve.
+var (
+	lastBroken = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "linkcheck_broken_links",
+		Help: "Errors found by the last crawl.",
+	})
+	lastWarnings = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "linkcheck_warnings",
+		Help: "Warnings found by the last crawl.",
+	})
+	lastChecked = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "linkcheck_checked_urls",
+		Help: "URLs checked by the last crawl.",
+	})
+	lastBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "linkcheck_downloaded_bytes",
+		Help: "Response body bytes downloaded by the last crawl.",
+	})
+	lastDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "linkcheck_last_crawl_duration_seconds",
+		Help: "Duration of the last crawl.",
+	})
+	lastFinished = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "linkcheck_last_crawl_timestamp_seconds",
+		Help: "When the last crawl finished.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(lastBroken, lastWarnings, lastChecked, lastBytes, lastDuration, lastFinished)
+}
+
+var (
+	latestMu sync.Mutex
+	latest   *crawlResult // most recent finished crawl, nil before the first
+)
+
+// serve crawls the site every -interval, serving the results over HTTP.
+// It doesn't return.
+func serve() {
+	// Not the default mux, which net/http/pprof adds its handlers to.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealth)
+	mux.HandleFunc("/report", handleReport)
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Fatal(http.ListenAndServe(*serveAddr, mux))
+	}()
+	log.Printf("serving on %s", *serveAddr)
+
+	for {
+		start := time.Now()
+		data := run()
+		res := &crawlResult{
+			reportData: data,
+			Finished:   time.Now(),
+			Duration:   time.Since(start),
+		}
+		if *verbose {
+			log.Printf("crawl finished in %v with %d errors", res.Duration, len(data.Problems)+data.Suppressed)
+		}
+		latestMu.Lock()
+		latest = res
+		latestMu.Unlock()
+		if *webhook != "" {
+			postWebhook(data)
+		}
+		if *sqlitePath != "" {
+			if err := writeSQLite(*sqlitePath, data, start, res.Finished); err != nil {
+				log.Printf("writing to SQLite database: %v", err)
+			}
+		}
+
+		lastBroken.Set(float64(len(data.Problems) + data.Suppressed))
+		lastWarnings.Set(float64(len(data.Warnings)))
+		lastChecked.Set(float64(data.Checked))
+		lastBytes.Set(float64(data.Bytes))
+		lastDuration.Set(res.Duration.Seconds())
+		lastFinished.Set(float64(res.Finished.Unix()))
+		time.Sleep(*interval)
+	}
+}
+
+func latestResult() *crawlResult {
+	latestMu.Lock()
+	defer latestMu.Unlock()
+	return latest
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	res := latestResult()
+	if res == nil {
+		http.Error(w, "first crawl still running", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("writing report: %v", err)
+	}
+}
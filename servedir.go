@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+)
+
+var serveDir = flag.String("serve-dir", "", "for debugging: serve this directory on a random local port and crawl it instead of -root")
+
+// serveDirectory serves dir over HTTP on a random loopback port for the
+// life of the process, and returns its root URL.
+func serveDirectory(dir string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("serving -serve-dir: %v", err)
+	}
+	go func() {
+		log.Fatal(http.Serve(l, http.FileServer(http.Dir(dir))))
+	}()
+	return "http://" + l.Addr().String() + "/"
+}
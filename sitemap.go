@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	sitemapURL   = flag.String("sitemap", "", "crawl from the URLs listed in this sitemap or sitemap index, resolved against -root, instead of from -root")
+	checkLastmod = flag.Bool("check-lastmod", false, "with -sitemap, warn about pages whose Last-Modified header is later than their sitemap <lastmod>, or whose <lastmod> is in the future")
+)
+
+// sitemapLastmods maps the URLs in the -sitemap to their <lastmod>, with
+// -check-lastmod. It's guarded by mu.
+var sitemapLastmods = make(map[string]time.Time)
+
+// A sitemap is a sitemap or a sitemap index; see sitemaps.org.
+type sitemap struct {
+	URLs []struct {
+		Loc     string `xml:"loc"`
+		Lastmod string `xml:"lastmod"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// checkSitemap crawls the URLs in the sitemap at rawurl, and in the
+// sitemaps it lists if it's a sitemap index.
+func checkSitemap(rawurl string) {
+	readSitemaps(rawurl, func(loc, lastmod string) {
+		if *checkLastmod && lastmod != "" {
+			noteLastmod(loc, lastmod)
+		}
+		crawl(loc, "")
+	})
+}
+
+// readSitemaps calls visit with each URL and its <lastmod> in the sitemap
+// at rawurl, and in the sitemaps it lists if it's a sitemap index.
+func readSitemaps(rawurl string, visit func(loc, lastmod string)) {
+	seen := make(map[string]bool)
+	var read func(string)
+	read = func(rawurl string) {
+		if seen[rawurl] {
+			return
+		}
+		seen[rawurl] = true
+		sm, err := fetchSitemap(rawurl)
+		if err != nil {
+			addProblem(kindSitemap, rawurl, err.Error())
+			return
+		}
+		for _, s := range sm.Sitemaps {
+			loc, err := parseUrl(strings.TrimSpace(s.Loc))
+			if err != nil {
+				addProblem(kindSitemap, rawurl, fmt.Sprintf("invalid <loc> %q: %v", s.Loc, err))
+				continue
+			}
+			noteLinkSource(loc, rawurl)
+			read(loc)
+		}
+		for _, u := range sm.URLs {
+			loc, err := parseUrl(strings.TrimSpace(u.Loc))
+			if err != nil {
+				addProblem(kindSitemap, rawurl, fmt.Sprintf("invalid <loc> %q: %v", u.Loc, err))
+				continue
+			}
+			noteLinkSource(loc, rawurl)
+			visit(loc, strings.TrimSpace(u.Lastmod))
+		}
+	}
+	read(rawurl)
+}
+
+func fetchSitemap(rawurl string) (*sitemap, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	authorize(req)
+	res, err := transportFor(req).RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, statusError{res.StatusCode, res.Status}
+	}
+	var sm sitemap
+	if err := xml.NewDecoder(countingReader{res.Body}).Decode(&sm); err != nil {
+		return nil, fmt.Errorf("parsing sitemap: %v", err)
+	}
+	return &sm, nil
+}
+
+// lastmodLayouts are the W3C datetime formats allowed in <lastmod>.
+var lastmodLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+func noteLastmod(url, lastmod string) {
+	for _, layout := range lastmodLayouts {
+		if t, err := time.Parse(layout, lastmod); err == nil {
+			if t.After(time.Now()) {
+				addWarning(url, "sitemap lastmod "+lastmod+" is in the future")
+			}
+			mu.Lock()
+			sitemapLastmods[url] = t
+			mu.Unlock()
+			return
+		}
+	}
+	addWarning(url, fmt.Sprintf("sitemap lastmod %q isn't a W3C datetime", lastmod))
+}
+
+// checkLastModified warns if the Last-Modified header of url's response
+// is more than a day after its sitemap <lastmod>, so the sitemap is stale.
+// Date-only <lastmod>s are taken as midnight UTC, hence the slack.
+func checkLastModified(url string, header http.Header) {
+	mu.Lock()
+	lastmod, ok := sitemapLastmods[url]
+	mu.Unlock()
+	if !ok || header.Get("Last-Modified") == "" {
+		return
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		log.Printf("parsing Last-Modified of %s: %v", url, err)
+		return
+	}
+	if modified.Sub(lastmod) > 24*time.Hour {
+		addWarning(url, fmt.Sprintf("modified %s, after sitemap lastmod %s", modified.Format(time.RFC3339), lastmod.Format(time.RFC3339)))
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"time"
+)
+
+var slowest = flag.Int("slowest", 0, "list the N URLs slowest to respond at the end of the report")
+
+// A slowURL is one of the -slowest URLs.
+type slowURL struct {
+	URL     string  `json:"url"`
+	Seconds float64 `json:"seconds"` // time to the response headers
+}
+
+// noteTiming records how long url took to respond, for -slowest.
+func noteTiming(url string, d time.Duration) {
+	problemsMu.Lock()
+	timings = append(timings, slowURL{url, d.Seconds()})
+	problemsMu.Unlock()
+}
+
+// slowestURLs returns the n slowest of the timings, slowest first.
+func slowestURLs(n int) []slowURL {
+	s := append([]slowURL(nil), timings...)
+	sort.Slice(s, func(i, j int) bool { return s[i].Seconds > s[j].Seconds })
+	if len(s) > n {
+		s = s[:n]
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var checkSocialMeta = flag.Bool("check-social-meta", false, "also check the Open Graph and Twitter Card URLs in <meta> tags (og:image, og:url, twitter:image), and that their images are valid images")
+
+// socialMeta maps the <meta> property or name of each social URL checked
+// by -check-social-meta to whether it's an image.
+var socialMeta = map[string]bool{
+	"og:url":              false,
+	"og:image":            true,
+	"og:image:url":        true,
+	"og:image:secure_url": true,
+	"twitter:image":       true,
+	"twitter:image:src":   true,
+}
+
+// socialImages are the URLs of social meta images, which must be valid
+// images. It's guarded by mu.
+var socialImages = make(map[string]bool)
+
+// socialMetaRef returns the URL in n if it's a social <meta> tag, and
+// whether it's an image.
+func socialMetaRef(n *html.Node) (ref string, isImage, ok bool) {
+	if n.Type != html.ElementNode || n.Data != "meta" {
+		return "", false, false
+	}
+	prop := attr(n, "property")
+	if prop == "" {
+		prop = attr(n, "name")
+	}
+	isImage, ok = socialMeta[strings.ToLower(prop)]
+	if !ok {
+		return "", false, false
+	}
+	ref, valid := cleanHref(attr(n, "content"))
+	if !valid || ref == "" {
+		return "", false, false
+	}
+	return ref, isImage, true
+}
+
+func noteSocialImage(url string) {
+	mu.Lock()
+	socialImages[url] = true
+	mu.Unlock()
+}
+
+func isSocialImage(url string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return socialImages[url]
+}
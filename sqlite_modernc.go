@@ -0,0 +1,92 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSupported is true when linkcheck is built with -tags sqlite.
+const sqliteSupported = true
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS crawls (
+	id       INTEGER PRIMARY KEY,
+	root     TEXT NOT NULL,
+	started  TEXT NOT NULL,
+	finished TEXT NOT NULL,
+	checked  INTEGER NOT NULL,
+	bytes    INTEGER NOT NULL,
+	errors   INTEGER NOT NULL,
+	warnings INTEGER NOT NULL,
+	stopped  INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS results (
+	crawl_id     INTEGER NOT NULL REFERENCES crawls(id),
+	url          TEXT NOT NULL,
+	status       INTEGER,
+	error        TEXT,
+	content_type TEXT
+);
+CREATE TABLE IF NOT EXISTS problems (
+	crawl_id INTEGER NOT NULL REFERENCES crawls(id),
+	severity TEXT NOT NULL, -- "error", "warning", or "known"
+	kind     TEXT,
+	url      TEXT NOT NULL,
+	fragment TEXT,
+	error    TEXT NOT NULL,
+	sources  TEXT NOT NULL -- newline-separated
+);
+`
+
+// writeSQLite adds the crawl's results to the SQLite database at path,
+// creating it if need be.
+func writeSQLite(path string, data reportData, started, finished time.Time) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO crawls (root, started, finished, checked, bytes, errors, warnings, stopped) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		base.String(), started.UTC().Format(time.RFC3339), finished.UTC().Format(time.RFC3339),
+		data.Checked, data.Bytes, len(data.Problems)+data.Suppressed, len(data.Warnings), data.Stopped)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, r := range data.Results {
+		if _, err := tx.Exec(`INSERT INTO results (crawl_id, url, status, error, content_type) VALUES (?, ?, ?, ?, ?)`,
+			id, r.URL, r.Status, r.Error, r.ContentType); err != nil {
+			return err
+		}
+	}
+	for _, ps := range []struct {
+		severity string
+		problems []problem
+	}{{"error", data.Problems}, {"warning", data.Warnings}, {"known", data.Known}} {
+		for _, p := range ps.problems {
+			if _, err := tx.Exec(`INSERT INTO problems (crawl_id, severity, kind, url, fragment, error, sources) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				id, ps.severity, p.Kind, p.URL, p.Frag, p.Err, strings.Join(p.Sources, "\n")); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
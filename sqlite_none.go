@@ -0,0 +1,17 @@
+//go:build !sqlite
+// +build !sqlite
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// sqliteSupported is false unless linkcheck is built with -tags sqlite,
+// which pulls in a SQLite driver.
+const sqliteSupported = false
+
+func writeSQLite(path string, data reportData, started, finished time.Time) error {
+	return errors.New("built without sqlite support")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var checkSRI = flag.Bool("check-sri", false, `check that the <script> and <link> subresources with an integrity attribute match their Subresource Integrity hashes, which browsers otherwise refuse to load`)
+
+// sriHashes are the Subresource Integrity hash algorithms, weakest first.
+var sriHashes = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha256", sha256.New},
+	{"sha384", sha512.New384},
+	{"sha512", sha512.New},
+}
+
+var (
+	integrities = make(map[string]map[string][]string) // URL -> integrity attribute -> pages declaring it, guarded by mu
+	digests     = make(map[string]map[string]string)   // URL -> algorithm -> base64 digest of its body, guarded by mu
+)
+
+// sriRef returns the URL and integrity attribute of n if it's a <script>
+// or <link> with one.
+func sriRef(n *html.Node) (ref, integrity string, ok bool) {
+	if n.Type != html.ElementNode {
+		return "", "", false
+	}
+	switch n.Data {
+	case "script":
+		ref = attr(n, "src")
+	case "link":
+		ref = attr(n, "href")
+	default:
+		return "", "", false
+	}
+	integrity = strings.TrimSpace(attr(n, "integrity"))
+	ref, valid := cleanHref(ref)
+	if !valid || ref == "" || integrity == "" {
+		return "", "", false
+	}
+	return ref, integrity, true
+}
+
+func noteIntegrity(url, integrity, pageURL string) {
+	if i := strings.Index(url, "#"); i >= 0 {
+		url = url[:i]
+	}
+	mu.Lock()
+	if integrities[url] == nil {
+		integrities[url] = make(map[string][]string)
+	}
+	integrities[url][integrity] = append(integrities[url][integrity], pageURL)
+	mu.Unlock()
+}
+
+// wantsDigest reports whether the body of url, with Content-Type ct, is
+// to be hashed with -check-sri: it's declared with an integrity attribute,
+// or it's a script or stylesheet that a page yet to be crawled might
+// declare one for.
+func wantsDigest(url, ct string) bool {
+	mu.Lock()
+	_, ok := integrities[url]
+	mu.Unlock()
+	if ok {
+		return true
+	}
+	mt, _, _ := mime.ParseMediaType(ct)
+	return mt == "text/css" || strings.HasSuffix(mt, "javascript")
+}
+
+// noteDigest records the digests of the body of url read from r.
+func noteDigest(url string, r io.Reader) error {
+	hashes := make([]hash.Hash, len(sriHashes))
+	writers := make([]io.Writer, len(sriHashes))
+	for i, h := range sriHashes {
+		hashes[i] = h.new()
+		writers[i] = hashes[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return fmt.Errorf("reading body: %v", err)
+	}
+	d := make(map[string]string)
+	for i, h := range sriHashes {
+		d[h.name] = base64.StdEncoding.EncodeToString(hashes[i].Sum(nil))
+	}
+	mu.Lock()
+	digests[url] = d
+	mu.Unlock()
+	return nil
+}
+
+// integrityMatches reports whether digest matches the integrity attribute,
+// and whether it could tell. As browsers do, only the hashes with the
+// strongest algorithm given are used, any of which may match; hashes with
+// unknown algorithms are ignored.
+func integrityMatches(integrity string, digest map[string]string) (match, known bool) {
+	byAlg := make(map[string][]string)
+	for _, tok := range strings.Fields(integrity) {
+		if i := strings.IndexByte(tok, '?'); i >= 0 {
+			tok = tok[:i] // options
+		}
+		if i := strings.IndexByte(tok, '-'); i > 0 {
+			byAlg[tok[:i]] = append(byAlg[tok[:i]], tok[i+1:])
+		}
+	}
+	for i := len(sriHashes) - 1; i >= 0; i-- {
+		name := sriHashes[i].name
+		if len(byAlg[name]) == 0 {
+			continue
+		}
+		for _, v := range byAlg[name] {
+			if v == digest[name] {
+				return true, true
+			}
+		}
+		return false, true
+	}
+	return false, false
+}
+
+// checkIntegrities reports the subresources that don't match the
+// integrity attributes declared for them, once the crawl is done.
+// Subresources that couldn't be fetched are reported as broken links.
+func checkIntegrities() {
+	var urls []string
+	for url := range integrities {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		digest, ok := digests[url]
+		if !ok {
+			continue
+		}
+		for integrity, pages := range integrities[url] {
+			if match, known := integrityMatches(integrity, digest); known && !match {
+				recordProblem(problem{Kind: kindIntegrity, URL: url, Err: fmt.Sprintf("doesn't match integrity %q", integrity), Sources: pages})
+			}
+		}
+	}
+}
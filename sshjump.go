@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	sshJump       = flag.String("ssh-jump", "", `"user@host[:port]" of an SSH bastion to make all connections through, for sites only reachable from behind it`)
+	sshKey        = flag.String("ssh-key", "~/.ssh/id_rsa", "private key file for -ssh-jump")
+	sshKnownHosts = flag.String("ssh-known-hosts", "~/.ssh/known_hosts", "known_hosts file with the -ssh-jump host's key")
+)
+
+// expandHome expands a leading ~/ in file to the home directory.
+func expandHome(file string) string {
+	if strings.HasPrefix(file, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, file[2:])
+		}
+	}
+	return file
+}
+
+// dialSSHJump connects to the -ssh-jump host.
+func dialSSHJump() (*ssh.Client, error) {
+	i := strings.LastIndex(*sshJump, "@")
+	if i <= 0 {
+		return nil, fmt.Errorf(`-ssh-jump %q must be "user@host[:port]"`, *sshJump)
+	}
+	user, addr := (*sshJump)[:i], (*sshJump)[i+1:]
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	key, err := ioutil.ReadFile(expandHome(*sshKey))
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("parsing -ssh-key: %v", err)
+	}
+	hostKeys, err := knownhosts.New(expandHome(*sshKnownHosts))
+	if err != nil {
+		return nil, err
+	}
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	})
+}
+
+// throughSSH returns a copy of rt, which must be an *http.Transport, that
+// makes its connections through client.
+func throughSSH(rt http.RoundTripper, client *ssh.Client) http.RoundTripper {
+	t := rt.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return client.DialContext(ctx, network, addr)
+	}
+	return t
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var failOn5xx = flag.Bool("fail-on-5xx", false, "report every 5xx response as broken, even one in the -baseline or from a page only fetched to check its ids with -exclude-check-fragments")
+
+// statuses counts the responses to the URLs crawled by status code, or
+// "timeout" or "error" for requests without a response. It's guarded by
+// problemsMu.
+var statuses = make(map[string]int)
+
+// noteStatus counts the response in fr, or err if there wasn't one. URLs
+// that weren't requested, like those trusted by -recheck-failures-only,
+// aren't counted.
+func noteStatus(fr fetchResult, err error) {
+	var class string
+	var timeout interface{ Timeout() bool }
+	switch {
+	case fr.status != 0:
+		class = strconv.Itoa(fr.status)
+	case err == nil:
+		return
+	case errors.As(err, &timeout) && timeout.Timeout():
+		class = "timeout"
+	default:
+		class = "error"
+	}
+	problemsMu.Lock()
+	statuses[class]++
+	problemsMu.Unlock()
+}
+
+// statusSummary formats counts like "200: 1198, 404: 37, timeout: 2",
+// status codes first.
+func statusSummary(counts map[string]int) string {
+	classes := make([]string, 0, len(counts))
+	for c := range counts {
+		classes = append(classes, c)
+	}
+	// Status codes are all three digits, so sort before the words.
+	sort.Strings(classes)
+	parts := make([]string, len(classes))
+	for i, c := range classes {
+		parts[i] = c + ": " + strconv.Itoa(counts[c])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// serverError reports whether p is a 5xx response.
+func serverError(p problem) bool {
+	return p.Kind == kindStatus && strings.HasPrefix(p.Err, "5")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestFailOn5xx checks that with -fail-on-5xx, 503s that would otherwise
+// be tolerated are reported, and so fail the run: one from a page only
+// fetched for its ids, and one in the -baseline.
+func TestFailOn5xx(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!doctype html><title>root</title><a href="/drafts/#a">draft</a><a href="/busy">busy</a>`)
+	}))
+	defer ts.Close()
+
+	defer func(paths listFlag) {
+		excludePaths, baseline = paths, nil
+	}(excludePaths)
+	excludePaths = listFlag{ts.URL + "/drafts/"}
+	baseline = map[baselineEntry]bool{
+		{ts.URL + "/", ts.URL + "/busy"}:      true,
+		{ts.URL + "/", ts.URL + "/drafts/#a"}: true,
+	}
+	flags := map[string]string{"exclude-check-fragments": "true"}
+
+	data := crawlTest(t, ts.URL, flags)
+	if len(data.Problems) != 0 {
+		t.Errorf("without -fail-on-5xx: problems %v, want none", problemURLs(data.Problems))
+	}
+	flags["fail-on-5xx"] = "true"
+	data = crawlTest(t, ts.URL, flags)
+	var got []string
+	for _, p := range data.Problems {
+		if p.Kind == kindStatus {
+			got = append(got, p.URL)
+		}
+	}
+	sort.Strings(got)
+	if want := []string{ts.URL + "/busy", ts.URL + "/drafts/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with -fail-on-5xx: status problems %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"strings"
+)
+
+var stdinMode = flag.Bool("stdin", false, "check the URLs read one per line from standard input, and their fragments, without crawling them; relative URLs are resolved against -root")
+
+// checkStdin checks the URLs listed on standard input.
+func checkStdin() {
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ref, err := parseUrl(line)
+		if err != nil {
+			addProblem(kindFetch, line, err.Error())
+			continue
+		}
+		page := ref
+		if i := strings.Index(page, "#"); i >= 0 {
+			page = page[:i]
+		}
+		// Like crawlAsset, but keeping the fragment to check.
+		mu.Lock()
+		if !isCrawled(page) {
+			noRecurse[page] = true
+		}
+		mu.Unlock()
+		crawl(ref, "")
+	}
+	if err := s.Err(); err != nil {
+		log.Fatalf("reading standard input: %v", err)
+	}
+}
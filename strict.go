@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	strictHTTPS   = flag.Bool("strict-https", false, "report every http:// link, internal or external, as an error")
+	httpOnlyHosts listFlag
+	insecureLinks = make(map[string]bool) // http links seen with -strict-https, guarded by mu
+
+	warnPrivateLinks = flag.Bool("warn-private-links", false, "warn about links to localhost and loopback or private IP addresses outside the site, likely left in by mistake")
+
+	canonicalHost = flag.String("canonical-host", "", "the site's preferred host, e.g. www.example.com; warn about links to its www or non-www variant, which likely redirect")
+
+	trailingSlash = flag.String("enforce-trailing-slash", "", `warn about internal links to directory-like paths (without a file extension) that "yes", end in a slash, or "no", don't`)
+
+	warnQueryLinks = flag.Bool("warn-on-query-in-internal-links", false, "warn about internal links with query strings, for sites that should only use clean URLs")
+
+	lowercasePaths = flag.Bool("enforce-lowercase-paths", false, "warn about internal links with uppercase letters in their paths, which break moving to a case-sensitive server")
+)
+
+func init() {
+	flag.Var(&httpOnlyHosts, "strict-https-allow", "hosts (and their subdomains) exempt from -strict-https, for third parties only served over http; may be repeated or comma-separated")
+}
+
+// noteInsecure records ref if it's an http link that -strict-https should
+// report.
+func noteInsecure(ref string) {
+	if !*strictHTTPS {
+		return
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "http" || hostMatches(ref, httpOnlyHosts) {
+		return
+	}
+	u.Fragment = ""
+	mu.Lock()
+	insecureLinks[u.String()] = true
+	mu.Unlock()
+}
+
+// checkInsecure reports the http links found with -strict-https, once
+// the crawl is done and all their sources are known.
+func checkInsecure() {
+	var urls []string
+	for u := range insecureLinks {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	for _, u := range urls {
+		addProblem(kindInsecure, u, "insecure http link")
+	}
+}
+
+// warnPrivate warns if sourceURL links to ref on a loopback or private
+// address, with -warn-private-links. Links within the site aren't
+// flagged, so a local site can still be checked.
+func warnPrivate(sourceURL, ref string) {
+	if !*warnPrivateLinks || isInternal(ref) {
+		return
+	}
+	u, err := url.Parse(ref)
+	if err != nil || !isPrivateHost(u.Hostname()) {
+		return
+	}
+	addWarning(sourceURL, "link to private address "+ref)
+}
+
+// isPrivateHost reports whether host is localhost or a loopback, private
+// (RFC 1918 or IPv6 unique local), or link-local address.
+func isPrivateHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified())
+}
+
+// warnQuery warns if sourceURL links to ref within the site with a query
+// string, which on a clean-URL site is often left over from old routing.
+func warnQuery(sourceURL, ref string) {
+	if !*warnQueryLinks || !isInternal(ref) {
+		return
+	}
+	if u, err := url.Parse(ref); err == nil && u.RawQuery != "" {
+		addWarning(sourceURL, "internal link with query string "+ref)
+	}
+}
+
+// warnHost warns if sourceURL links to ref on the www or non-www variant
+// of the -canonical-host.
+func warnHost(sourceURL, ref string) {
+	if *canonicalHost == "" {
+		return
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return
+	}
+	host := strings.ToLower(u.Hostname())
+	canonical := strings.ToLower(*canonicalHost)
+	if host != canonical && strings.TrimPrefix(host, "www.") == strings.TrimPrefix(canonical, "www.") {
+		addWarning(sourceURL, fmt.Sprintf("link to %s rather than canonical host %s", ref, *canonicalHost))
+	}
+}
+
+// warnSlash warns if sourceURL links within the site to a directory-like
+// path, one whose last segment has no extension, that doesn't follow the
+// -enforce-trailing-slash policy.
+func warnSlash(sourceURL, ref string) {
+	if *trailingSlash == "" || !isInternal(ref) {
+		return
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Path == "/" {
+		return
+	}
+	hasSlash := strings.HasSuffix(u.Path, "/")
+	switch {
+	case *trailingSlash == "yes" && !hasSlash && !strings.Contains(path.Base(u.Path), "."):
+		addWarning(sourceURL, "link without trailing slash "+ref)
+	case *trailingSlash == "no" && hasSlash:
+		addWarning(sourceURL, "link with trailing slash "+ref)
+	}
+}
+
+// warnCase warns if sourceURL links within the site to a path with
+// uppercase letters, with -enforce-lowercase-paths. The root's own path
+// is as given.
+func warnCase(sourceURL, ref string) {
+	if !*lowercasePaths || !isInternal(ref) {
+		return
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return
+	}
+	if p := strings.TrimPrefix(u.Path, base.Path); p != strings.ToLower(p) {
+		addWarning(sourceURL, "link with uppercase path "+ref)
+	}
+}
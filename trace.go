@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+var (
+	trace     = flag.Bool("trace", false, "log the DNS, connect, TLS, and time to first byte breakdown of requests slower than -trace-slow")
+	traceSlow = flag.Duration("trace-slow", time.Second, "with -trace, the response time above which requests are logged")
+)
+
+// traced returns req with an httptrace.ClientTrace attached, and a
+// function to call once the response headers arrive, which logs the
+// timings if the request was slow.
+func traced(req *http.Request) (*http.Request, func()) {
+	start := time.Now()
+	// The hooks may be called from the transport's dialing goroutines.
+	var mu sync.Mutex
+	var dnsStart, dnsDone, connStart, connDone, tlsStart, tlsDone, firstByte time.Time
+	at := func(t *time.Time) {
+		mu.Lock()
+		*t = time.Now()
+		mu.Unlock()
+	}
+	ct := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { at(&dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { at(&dnsDone) },
+		ConnectStart:         func(string, string) { at(&connStart) },
+		ConnectDone:          func(string, string, error) { at(&connDone) },
+		TLSHandshakeStart:    func() { at(&tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { at(&tlsDone) },
+		GotFirstResponseByte: func() { at(&firstByte) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), ct))
+	return req, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		total := time.Since(start)
+		if total < *traceSlow {
+			return
+		}
+		ttfb := time.Duration(0)
+		if !firstByte.IsZero() {
+			ttfb = firstByte.Sub(start)
+		}
+		log.Printf("slow request %s: %v total, dns %v, connect %v, tls %v, first byte %v",
+			req.URL, total, since(dnsStart, dnsDone), since(connStart, connDone), since(tlsStart, tlsDone), ttfb)
+	}
+}
+
+// since returns the time from start to end, or 0 if either didn't happen,
+// as when a connection is reused.
+func since(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,12 @@
+//go:build !tui
+// +build !tui
+
+package main
+
+// tuiSupported is false unless linkcheck is built with -tags tui, which
+// pulls in tview.
+const tuiSupported = false
+
+func runTUI() reportData {
+	panic("built without tui support")
+}
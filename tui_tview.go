@@ -0,0 +1,150 @@
+//go:build tui
+// +build tui
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const tuiSupported = true
+
+// runTUI crawls the site like run, showing the pages crawled and the
+// problems found so far as it goes. The problems can be scrolled and
+// filtered; Tab switches between the problems and the filter, and q or
+// Escape quits once the crawl is done.
+func runTUI() reportData {
+	app := tview.NewApplication()
+	status := tview.NewTextView().SetDynamicColors(true)
+	pagesView := tview.NewTextView().SetDynamicColors(true).SetMaxLines(1000).ScrollToEnd()
+	pagesView.SetBorder(true).SetTitle(" Crawled ")
+	problemsView := tview.NewTable().SetSelectable(true, false)
+	problemsView.SetBorder(true).SetTitle(" Problems ")
+	filter := tview.NewInputField().SetLabel("Filter: ")
+
+	var (
+		newMu    sync.Mutex
+		newPages []string // crawled since the last refresh
+		done     bool
+		data     reportData
+	)
+	fetched = func(url string, err error) {
+		line := tview.Escape(url)
+		if err != nil {
+			line = "[red]" + line + "[-]"
+		}
+		newMu.Lock()
+		newPages = append(newPages, line)
+		newMu.Unlock()
+	}
+
+	refresh := func() {
+		newMu.Lock()
+		lines := newPages
+		newPages = nil
+		finished := done
+		newMu.Unlock()
+		for _, l := range lines {
+			fmt.Fprintln(pagesView, l)
+		}
+
+		problemsMu.Lock()
+		ps := append([]problem(nil), problems...)
+		ws := append([]problem(nil), warnings...)
+		problemsMu.Unlock()
+		mu.Lock()
+		checked := crawledCount()
+		mu.Unlock()
+
+		state := "crawling"
+		if finished {
+			state = "[green]done[-], press q to quit"
+		}
+		status.SetText(fmt.Sprintf(" %s. Checked %d URLs, %d queued, %d errors, %d warnings",
+			state, checked, atomic.LoadInt64(&pending), len(ps), len(ws)))
+
+		q := strings.ToLower(filter.GetText())
+		problemsView.Clear()
+		row := 0
+		add := func(text, color string) {
+			if q != "" && !strings.Contains(strings.ToLower(text), q) {
+				return
+			}
+			problemsView.SetCell(row, 0, tview.NewTableCell(text).SetTextColor(tcell.GetColor(color)))
+			row++
+		}
+		for _, p := range ps {
+			add(p.String(), "red")
+		}
+		for _, p := range ws {
+			add(p.warning(), "yellow")
+		}
+	}
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(status, 1, 0, false).
+		AddItem(tview.NewFlex().
+			AddItem(pagesView, 0, 1, false).
+			AddItem(problemsView, 0, 2, true), 0, 1, true).
+		AddItem(filter, 1, 0, false)
+
+	app.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case ev.Key() == tcell.KeyTab:
+			if filter.HasFocus() {
+				app.SetFocus(problemsView)
+			} else {
+				app.SetFocus(filter)
+			}
+			return nil
+		case ev.Key() == tcell.KeyEscape || ev.Rune() == 'q' && !filter.HasFocus():
+			newMu.Lock()
+			finished := done
+			newMu.Unlock()
+			if finished {
+				app.Stop()
+			}
+			return nil
+		}
+		return ev
+	})
+
+	// Log output would garble the screen.
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	go func() {
+		d := run()
+		newMu.Lock()
+		data, done = d, true
+		newMu.Unlock()
+		app.QueueUpdateDraw(refresh)
+	}()
+	go func() {
+		for range time.Tick(250 * time.Millisecond) {
+			app.QueueUpdateDraw(refresh)
+		}
+	}()
+
+	if err := app.SetRoot(layout, true).Run(); err != nil {
+		log.SetOutput(os.Stderr)
+		log.Fatalf("running terminal UI: %v", err)
+	}
+	newMu.Lock()
+	defer newMu.Unlock()
+	if !done {
+		// Stopped with Ctrl-C before the crawl finished.
+		os.Exit(1)
+	}
+	return data
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+var suggestWayback = flag.Bool("suggest-wayback", false, "for external links that are gone (404 or 410), look up the Internet Archive's closest snapshot and include it in the report as a replacement")
+
+// waybackAPI is the Internet Archive's availability API.
+const waybackAPI = "https://archive.org/wayback/available"
+
+// gone reports whether the status code of a broken link means the page
+// is gone, rather than, say, the server failing.
+func gone(code int) bool {
+	return code == http.StatusNotFound || code == http.StatusGone
+}
+
+// waybackSnapshot returns the URL of the Internet Archive's closest
+// snapshot of rawurl, or "" if there isn't one or it can't be looked up.
+func waybackSnapshot(rawurl string) string {
+	req, err := http.NewRequest("GET", waybackAPI+"?url="+url.QueryEscape(rawurl), nil)
+	if err != nil {
+		return ""
+	}
+	res, err := roundTrip(req)
+	if err != nil {
+		log.Printf("looking up %s in the Wayback Machine: %v", rawurl, err)
+		return ""
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		log.Printf("looking up %s in the Wayback Machine: %s", rawurl, res.Status)
+		return ""
+	}
+	var v struct {
+		ArchivedSnapshots struct {
+			Closest struct {
+				Available bool   `json:"available"`
+				URL       string `json:"url"`
+			} `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&v); err != nil {
+		log.Printf("looking up %s in the Wayback Machine: %v", rawurl, err)
+		return ""
+	}
+	if c := v.ArchivedSnapshots.Closest; c.Available {
+		return c.URL
+	}
+	return ""
+}
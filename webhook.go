@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+var webhook = flag.String("webhook", "", "POST the JSON report to this URL when each crawl finishes")
+
+// webhookAttempts is how many times postWebhook tries to deliver a report.
+const webhookAttempts = 3
+
+// postWebhook POSTs data as JSON to the -webhook URL, retrying failed
+// deliveries with backoff. Failures are logged rather than fatal, since
+// the crawl itself succeeded.
+func postWebhook(data reportData) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("encoding webhook report: %v", err)
+		return
+	}
+	wait := time.Second
+	for i := 1; ; i++ {
+		err = sendWebhook(body)
+		if err == nil {
+			return
+		}
+		if i == webhookAttempts {
+			break
+		}
+		if *verbose {
+			log.Printf("webhook attempt %d failed, retrying in %v: %v", i, wait, err)
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+	log.Printf("posting report to webhook: %v", err)
+}
+
+func sendWebhook(body []byte) error {
+	resp, err := http.Post(*webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}